@@ -105,8 +105,22 @@ func (a *inMemoryAdapter) Broadcast(header *parser.PacketHeader, v []any, opts *
 		panic(fmt.Errorf("sio: %w", err))
 	}
 
+	store, ok := a.sockets.(PacketSocketStore)
+	if !ok {
+		a.apply(opts, func(socket Socket) {
+			a.sockets.SendBuffers(socket.ID(), buffers)
+		})
+		return
+	}
+
+	// Create the packets once and share them between the recipients.
+	packets, err := store.NewPackets(buffers, opts.Flags.Compress)
+	if err != nil {
+		panic(fmt.Errorf("sio: %w", err))
+	}
+
 	a.apply(opts, func(socket Socket) {
-		a.sockets.SendBuffers(socket.ID(), buffers)
+		store.SendPackets(socket.ID(), packets)
 	})
 }
 
@@ -187,7 +201,7 @@ func (a *inMemoryAdapter) apply(opts *BroadcastOptions, callback func(socket Soc
 			}
 
 			r.Each(func(sid SocketID) bool {
-				if ids.Contains(sid) || exceptSids.Contains(sid) {
+				if ids.ContainsOne(sid) || exceptSids.ContainsOne(sid) {
 					return false
 				}
 				socket, ok := a.sockets.Get(sid)
@@ -201,7 +215,8 @@ func (a *inMemoryAdapter) apply(opts *BroadcastOptions, callback func(socket Soc
 		})
 	} else {
 		for sid := range a.sids {
-			if exceptSids.Contains(sid) {
+			// ContainsOne doesn't allocate, unlike the variadic Contains.
+			if exceptSids.ContainsOne(sid) {
 				continue
 			}
 			socket, ok := a.sockets.Get(sid)
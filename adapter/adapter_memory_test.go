@@ -6,6 +6,7 @@ import (
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	eioparser "github.com/tomruk/socket.io-go/engine.io/parser"
 	"github.com/tomruk/socket.io-go/parser"
 	jsonparser "github.com/tomruk/socket.io-go/parser/json"
 	"github.com/tomruk/socket.io-go/parser/json/serializer/stdjson"
@@ -230,6 +231,63 @@ func TestReturnMatchingSocketsWithinRoom(t *testing.T) {
 	require.Equal(t, SocketID("s2"), sockets[0].ID())
 }
 
+func TestBroadcastWithPacketSocketStore(t *testing.T) {
+	store := &testPacketSocketStore{TestSocketStore: NewTestSocketStore()}
+	adapter := NewInMemoryAdapterCreator()(store, jsonparser.NewCreator(0, stdjson.New())).(*inMemoryAdapter)
+	adapter.AddAll("s1", nil)
+	adapter.AddAll("s2", nil)
+	store.Set(NewTestSocket("s1"))
+	store.Set(NewTestSocket("s2"))
+
+	store.sendBuffers = func(sid SocketID, buffers [][]byte) (ok bool) {
+		t.Error("SendBuffers should not be used")
+		return
+	}
+
+	opts := NewBroadcastOptions()
+	opts.Flags.Compress = false
+	adapter.Broadcast(&parser.PacketHeader{}, []any{"123"}, opts)
+
+	require.Equal(t, 1, store.created)
+	require.Equal(t, 2, len(store.sent))
+	for _, packets := range store.sent {
+		require.Equal(t, 1, len(packets))
+		// The packets should be created once and shared.
+		assert.True(t, packets[0] == store.sent["s1"][0])
+		assert.Equal(t, `0["123"]`, string(packets[0].Data))
+		assert.True(t, packets[0].SkipCompression)
+	}
+}
+
+type testPacketSocketStore struct {
+	*TestSocketStore
+
+	created int
+	sent    map[SocketID][]*eioparser.Packet
+}
+
+func (s *testPacketSocketStore) NewPackets(buffers [][]byte, compress bool) ([]*eioparser.Packet, error) {
+	s.created++
+	packets := make([]*eioparser.Packet, len(buffers))
+	for i, buf := range buffers {
+		packet, err := eioparser.NewPacket(eioparser.PacketTypeMessage, i > 0, buf)
+		if err != nil {
+			return nil, err
+		}
+		packet.SkipCompression = !compress
+		packets[i] = packet
+	}
+	return packets, nil
+}
+
+func (s *testPacketSocketStore) SendPackets(sid SocketID, packets []*eioparser.Packet) (ok bool) {
+	if s.sent == nil {
+		s.sent = make(map[SocketID][]*eioparser.Packet)
+	}
+	s.sent[sid] = packets
+	return true
+}
+
 func newTestInMemoryAdapter() *inMemoryAdapter {
 	creator := NewInMemoryAdapterCreator()
 	return creator(NewTestSocketStore(), jsonparser.NewCreator(0, stdjson.New())).(*inMemoryAdapter)
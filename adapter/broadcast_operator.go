@@ -28,7 +28,9 @@ type (
 	}
 
 	BroadcastFlags struct {
-		// This flag is unused at the moment, but for compatibility with the socket.io API, it stays here.
+		// Whether to compress the event data (only applies to the websocket transport with permessage-deflate
+		// enabled, and to the polling transport with HTTP compression enabled).
+		// This is set to true by NewBroadcastOptions and NewBroadcastOperator.
 		Compress bool
 		Local    bool
 	}
@@ -38,6 +40,7 @@ func NewBroadcastOptions() *BroadcastOptions {
 	return &BroadcastOptions{
 		Rooms:  mapset.NewSet[Room](),
 		Except: mapset.NewSet[Room](),
+		Flags:  BroadcastFlags{Compress: true},
 	}
 }
 
@@ -51,6 +54,7 @@ func NewBroadcastOperator(
 		adapter:         adapter,
 		rooms:           mapset.NewSet[Room](),
 		exceptRooms:     mapset.NewSet[Room](),
+		flags:           BroadcastFlags{Compress: true},
 		isEventReserved: isEventReserved,
 	}
 }
@@ -114,7 +118,11 @@ func (b *BroadcastOperator) Except(room ...Room) *BroadcastOperator {
 	return &n
 }
 
-// Compression flag is unused at the moment, thus setting this will have no effect on compression.
+// Sets a modifier for a subsequent event emission that the event data will
+// only be compressed if the value is true (only applies to the websocket transport with permessage-deflate
+// enabled, and to the polling transport with HTTP compression enabled).
+//
+// Default: true
 func (b *BroadcastOperator) Compress(compress bool) *BroadcastOperator {
 	n := *b
 	n.flags.Compress = compress
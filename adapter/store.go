@@ -1,5 +1,9 @@
 package adapter
 
+import (
+	eioparser "github.com/tomruk/socket.io-go/engine.io/parser"
+)
+
 type SocketStore interface {
 	// Send Engine.IO packets to a specific socket.
 	SendBuffers(sid SocketID, buffers [][]byte) (ok bool)
@@ -9,3 +13,19 @@ type SocketStore interface {
 
 	Remove(sid SocketID)
 }
+
+// A SocketStore can optionally implement this interface to send the same packets to multiple sockets.
+// The in-memory adapter checks for it with a type assertion. If the store doesn't implement it,
+// the buffers are sent with SendBuffers (and the compression flag of the broadcast has no effect).
+type PacketSocketStore interface {
+	SocketStore
+
+	// Create the Engine.IO packets of the buffers. If compress is false, the packets will be sent without compression.
+	//
+	// The packets can be sent to multiple sockets with SendPackets, so that they are created once per broadcast
+	// instead of once per socket. The buffers must not be modified after this call.
+	NewPackets(buffers [][]byte, compress bool) ([]*eioparser.Packet, error)
+
+	// Send the packets created with NewPackets to a specific socket.
+	SendPackets(sid SocketID, packets []*eioparser.Packet) (ok bool)
+}
@@ -1,6 +1,7 @@
 package sio
 
 import (
+	"context"
 	"time"
 
 	"github.com/tomruk/socket.io-go/internal/sync"
@@ -18,6 +19,9 @@ type (
 		ParserCreator parser.Creator
 
 		// Configuration for the Engine.IO.
+		//
+		// The same configuration is used for every (re)connection attempt.
+		// Use EIO.RequestHeaderFunc and EIO.QueryFunc for the credentials that must be refreshed on reconnection.
 		EIO eio.ClientConfig
 
 		// Should we disallow reconnections?
@@ -53,6 +57,9 @@ type (
 		eioConfig eio.ClientConfig
 		debug     Debugger
 
+		// The transport remembered across the (re)connections. See eio.ClientConfig.RememberUpgrade.
+		rememberedUpgrade eio.RememberedUpgrade
+
 		state   clientConnectionState
 		stateMu sync.RWMutex
 
@@ -195,6 +202,20 @@ func (m *Manager) socket(namespace string, config *ClientSocketConfig) *clientSo
 	return socket
 }
 
+// Transport statistics of the underlying Engine.IO connection.
+// ok is false if the manager is not connected.
+func (m *Manager) Stats() (stats eio.SocketStats, ok bool) {
+	if !m.connected() {
+		return
+	}
+	m.eioMu.RLock()
+	defer m.eioMu.RUnlock()
+	if m.eio == nil {
+		return
+	}
+	return m.eio.Stats(), true
+}
+
 func (m *Manager) onEIOPacket(packets ...*eioparser.Packet) {
 	m.parserMu.Lock()
 	defer m.parserMu.Unlock()
@@ -236,21 +257,22 @@ func (m *Manager) onError(err error) {
 }
 
 func (m *Manager) Open() {
-	go m.open()
+	go m.open(context.Background())
 }
 
-func (m *Manager) open() {
+// ctx bounds the connection and the reconnection attempts made if the connection fails.
+func (m *Manager) open(ctx context.Context) {
 	m.debug.Log("Opening")
-	err := m.connect(false)
+	err := m.connect(ctx, false)
 	if err != nil {
-		m.maybeReconnectOnOpen()
+		m.maybeReconnectOnOpen(ctx)
 	}
 }
 
-func (m *Manager) maybeReconnectOnOpen() {
+func (m *Manager) maybeReconnectOnOpen(ctx context.Context) {
 	reconnect := m.backoff.attempts() == 0 && !m.noReconnection
 	if reconnect {
-		m.reconnect(false)
+		m.reconnect(ctx, false)
 	}
 }
 
@@ -293,7 +315,7 @@ func (m *Manager) onClose(reason Reason, err error) {
 	skipReconnect := m.skipReconnect
 	m.skipReconnectMu.RUnlock()
 	if !m.noReconnection && !skipReconnect {
-		go m.reconnect(false)
+		go m.reconnect(context.Background(), false)
 	}
 }
 
@@ -1,6 +1,7 @@
 package sio
 
 import (
+	"context"
 	"math"
 	"time"
 
@@ -25,7 +26,7 @@ func (m *Manager) connected() bool {
 	return m.state == clientConnStateConnected
 }
 
-func (m *Manager) connect(recursed bool) (err error) {
+func (m *Manager) connect(ctx context.Context, recursed bool) (err error) {
 	// recursed = Is this the first time we're running the connect method?
 	// In other words: are we recursing?
 	if !recursed {
@@ -51,7 +52,7 @@ func (m *Manager) connect(recursed bool) (err error) {
 		OnClose:  m.onClose,
 	}
 
-	_eio, err := eio.Dial(m.url, &callbacks, &m.eioConfig)
+	_eio, err := eio.DialRememberingUpgrade(ctx, m.url, &callbacks, &m.eioConfig, &m.rememberedUpgrade)
 	if err != nil {
 		m.resetParser()
 		m.state = clientConnStateDisconnected
@@ -70,7 +71,8 @@ func (m *Manager) connect(recursed bool) (err error) {
 	return
 }
 
-func (m *Manager) reconnect(recursed bool) {
+// The reconnection attempts are stopped when ctx is done.
+func (m *Manager) reconnect(ctx context.Context, recursed bool) {
 	m.debug.Log("`reconnect` called")
 
 	// recursed = Is this the first time we're running the reconnect method?
@@ -111,7 +113,14 @@ func (m *Manager) reconnect(recursed bool) {
 
 	delay := m.backoff.duration()
 	m.debug.Log("Delay before reconnect attempt", delay)
-	time.Sleep(delay)
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		m.debug.Log("Context is done. Stopping reconnection")
+		m.backoff.reset()
+		m.state = clientConnStateDisconnected
+		return
+	}
 
 	if m.skipReconnect {
 		m.debug.Log("Skipping reconnect")
@@ -127,12 +136,16 @@ func (m *Manager) reconnect(recursed bool) {
 	}
 
 	m.debug.Log("Attempting to reconnect")
-	err := m.connect(true)
+	err := m.connect(ctx, true)
 	if err != nil {
 		m.debug.Log("Reconnect failed", err)
 		m.state = clientConnStateDisconnected
 		m.reconnectErrorHandlers.forEach(func(handler *ManagerReconnectErrorFunc) { (*handler)(err) }, true)
-		m.reconnect(true)
+		if ctx.Err() != nil {
+			m.debug.Log("Context is done. Stopping reconnection")
+			return
+		}
+		m.reconnect(ctx, true)
 		return
 	}
 	m.debug.Log("Reconnected")
@@ -19,9 +19,10 @@ type (
 	}
 
 	queuedPacket struct {
-		id     uint64
-		header *parser.PacketHeader
-		v      []any
+		id       uint64
+		header   *parser.PacketHeader
+		v        []any
+		compress bool
 
 		mu       *sync.Mutex
 		tryCount int
@@ -39,7 +40,7 @@ func newClientPacketQueue(socket *clientSocket) *clientPacketQueue {
 	}
 }
 
-func (pq *clientPacketQueue) addToQueue(header *parser.PacketHeader, v []any) {
+func (pq *clientPacketQueue) addToQueue(header *parser.PacketHeader, v []any, compress bool) {
 	haveAck := false
 	f := v[len(v)-1]
 	rv := reflect.ValueOf(f)
@@ -50,9 +51,10 @@ func (pq *clientPacketQueue) addToQueue(header *parser.PacketHeader, v []any) {
 	}
 
 	packet := &queuedPacket{
-		id:     pq.nextSeq(),
-		header: header,
-		mu:     new(sync.Mutex),
+		id:       pq.nextSeq(),
+		header:   header,
+		compress: compress,
+		mu:       new(sync.Mutex),
 	}
 
 	replacementAck := func(args []reflect.Value) (results []reflect.Value) {
@@ -132,7 +134,7 @@ func (pq *clientPacketQueue) drainQueue(force bool) {
 	packet.mu.Unlock()
 
 	pq.debug.Log("Sending packet with ID", packet.id, "try", tryCount)
-	go pq.socket.emit("", 0, false, true, packet.v...)
+	go pq.socket.emit("", 0, false, packet.compress, true, packet.v...)
 }
 
 func (pq *clientPacketQueue) nextSeq() uint64 {
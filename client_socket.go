@@ -1,7 +1,9 @@
 package sio
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"sync/atomic"
@@ -215,6 +217,53 @@ func (s *clientSocket) deregisterSubEvents() {
 }
 
 func (s *clientSocket) Connect() {
+	s.connect(context.Background())
+}
+
+func (s *clientSocket) ConnectContext(ctx context.Context) error {
+	if s.Connected() {
+		return nil
+	}
+
+	errChan := make(chan error, 1)
+	done := func(err error) {
+		select {
+		case errChan <- err:
+		default:
+		}
+	}
+	var (
+		onConnect      ClientSocketConnectFunc      = func() { done(nil) }
+		onConnectError ClientSocketConnectErrorFunc = func(err error) {
+			// Errors of the Engine.IO connection are retried by the manager (unless the reconnection is disabled).
+			var ce *ConnectError
+			if errors.As(err, &ce) || s.manager.noReconnection {
+				done(err)
+			}
+		}
+		onReconnectFailed ManagerReconnectFailedFunc = func() {
+			done(fmt.Errorf("sio: reconnection failed"))
+		}
+	)
+	s.connectHandlers.on(&onConnect)
+	defer s.connectHandlers.off(&onConnect)
+	s.connectErrorHandlers.on(&onConnectError)
+	defer s.connectErrorHandlers.off(&onConnectError)
+	s.manager.reconnectFailedHandlers.on(&onReconnectFailed)
+	defer s.manager.reconnectFailedHandlers.off(&onReconnectFailed)
+
+	s.connect(ctx)
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		s.Disconnect()
+		return ctx.Err()
+	}
+}
+
+func (s *clientSocket) connect(ctx context.Context) {
 	s.stateMu.Lock()
 	defer s.stateMu.Unlock()
 
@@ -228,7 +277,7 @@ func (s *clientSocket) Connect() {
 	managerConnState := s.manager.state
 	s.manager.stateMu.RUnlock()
 	if managerConnState != clientConnStateReconnecting {
-		go s.manager.open()
+		go s.manager.open(ctx)
 	}
 
 	// If already connected, send a CONNECT packet.
@@ -506,15 +555,19 @@ func (s *clientSocket) emitBuffered() {
 	}
 }
 
-type connectError struct {
+// The error sent by the server when it rejects the connection to a namespace (CONNECT_ERROR).
+// It is returned by ConnectContext and passed to the OnConnectError handlers.
+type ConnectError struct {
 	Message string          `json:"message"`
 	Data    json.RawMessage `json:"data,omitempty"`
 }
 
+func (e *ConnectError) Error() string { return "sio: " + e.Message }
+
 func (s *clientSocket) onConnectError(_ *parser.PacketHeader, decode parser.Decode) {
 	s.destroy()
 
-	var v *connectError
+	var v *ConnectError
 	vt := reflect.TypeOf(v)
 	values, err := decode(vt)
 	if err != nil {
@@ -525,12 +578,12 @@ func (s *clientSocket) onConnectError(_ *parser.PacketHeader, decode parser.Deco
 		return
 	}
 
-	v, ok := values[0].Interface().(*connectError)
+	v, ok := values[0].Interface().(*ConnectError)
 	if !ok {
 		s.onError(wrapInternalError(fmt.Errorf("invalid CONNECT_ERROR packet: cast failed")))
 		return
 	}
-	s.connectErrorHandlers.forEach(func(handler *ClientSocketConnectErrorFunc) { (*handler)(fmt.Errorf("sio: %s", v.Message)) }, false)
+	s.connectErrorHandlers.forEach(func(handler *ClientSocketConnectErrorFunc) { (*handler)(v) }, false)
 }
 
 func (s *clientSocket) onDisconnect() {
@@ -672,13 +725,13 @@ func (s *clientSocket) onAck(header *parser.PacketHeader, decode parser.Decode)
 }
 
 func (s *clientSocket) Emit(eventName string, v ...any) {
-	s.emit(eventName, 0, false, false, v...)
+	s.emit(eventName, 0, false, true, false, v...)
 }
 
 func (s *clientSocket) emit(
 	eventName string,
 	timeout time.Duration,
-	volatile, fromQueue bool,
+	volatile, compress, fromQueue bool,
 	v ...any,
 ) {
 	header := parser.PacketHeader{
@@ -695,7 +748,7 @@ func (s *clientSocket) emit(
 	}
 
 	if s.config.Retries > 0 && !fromQueue && !volatile {
-		s.packetQueue.addToQueue(&header, v)
+		s.packetQueue.addToQueue(&header, v, compress)
 		return
 	}
 
@@ -713,7 +766,7 @@ func (s *clientSocket) emit(
 		return
 	}
 
-	s.sendBuffers(volatile, false, header.ID, buffers...)
+	s.sendBuffers(volatile, compress, false, header.ID, buffers...)
 }
 
 // 0 as the timeout argument means there is no timeout.
@@ -785,6 +838,13 @@ func (s *clientSocket) Volatile() Emitter {
 	}
 }
 
+func (s *clientSocket) Compress(compress bool) Emitter {
+	return Emitter{
+		socket:     s,
+		noCompress: !compress,
+	}
+}
+
 func (s *clientSocket) sendControlPacket(typ parser.PacketType, v any) {
 	header := parser.PacketHeader{
 		Type:      typ,
@@ -801,7 +861,7 @@ func (s *clientSocket) sendControlPacket(typ parser.PacketType, v any) {
 		s.onError(wrapInternalError(err))
 		return
 	}
-	s.sendBuffers(false, true, nil, buffers...)
+	s.sendBuffers(false, true, true, nil, buffers...)
 }
 
 func (s *clientSocket) sendAckPacket(id uint64, values []reflect.Value) {
@@ -828,10 +888,11 @@ func (s *clientSocket) sendAckPacket(id uint64, values []reflect.Value) {
 		return
 	}
 
-	s.sendBuffers(false, false, header.ID, buffers...)
+	s.sendBuffers(false, true, false, header.ID, buffers...)
 }
 
-func (s *clientSocket) sendBuffers(volatile, forceSend bool, ackID *uint64, buffers ...[]byte) {
+// If compress is false, the packets will be sent without compression.
+func (s *clientSocket) sendBuffers(volatile, compress, forceSend bool, ackID *uint64, buffers ...[]byte) {
 	if len(buffers) > 0 {
 		packets := make([]*eioparser.Packet, len(buffers))
 		buf := buffers[0]
@@ -843,6 +904,7 @@ func (s *clientSocket) sendBuffers(volatile, forceSend bool, ackID *uint64, buff
 			s.onError(wrapInternalError(err))
 			return
 		}
+		packets[0].SkipCompression = !compress
 
 		for i, attachment := range buffers {
 			packets[i+1], err = eioparser.NewPacket(eioparser.PacketTypeMessage, true, attachment)
@@ -850,6 +912,7 @@ func (s *clientSocket) sendBuffers(volatile, forceSend bool, ackID *uint64, buff
 				s.onError(wrapInternalError(err))
 				return
 			}
+			packets[i+1].SkipCompression = !compress
 		}
 
 		s.stateMu.RLock()
@@ -1,9 +1,18 @@
 package sio
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	eio "github.com/tomruk/socket.io-go/engine.io"
+	eioparser "github.com/tomruk/socket.io-go/engine.io/parser"
 	"github.com/tomruk/socket.io-go/internal/sync"
 
 	"github.com/stretchr/testify/assert"
@@ -146,6 +155,101 @@ func TestClient(t *testing.T) {
 		tw.WaitTimeout(t, defaultTestWaitTimeout)
 	})
 
+	t.Run("should reconnect with the remembered transport if `RememberUpgrade` is set", func(t *testing.T) {
+		upgraded := make(chan struct{}, 1)
+		server, _, manager := newTestServerAndClient(
+			t,
+			nil,
+			&ManagerConfig{
+				EIO: eio.ClientConfig{
+					Transports:      []string{"polling", "websocket"},
+					RememberUpgrade: true,
+					UpgradeDone: func(transportName string) {
+						upgraded <- struct{}{}
+					},
+				},
+			},
+		)
+		socket := manager.Socket("/", nil)
+		connectedWith := make(chan string, 2)
+		closeFirst := make(chan *serverSocket, 1)
+
+		server.OnConnection(func(socket ServerSocket) {
+			s := socket.(*serverSocket)
+			connectedWith <- s.conn.eio.TransportName()
+			select {
+			case closeFirst <- s:
+			default:
+			}
+		})
+		socket.Connect()
+		defer socket.Disconnect()
+
+		require.Equal(t, "polling", <-connectedWith)
+		select {
+		case <-upgraded:
+		case <-time.After(defaultTestWaitTimeout):
+			t.Fatal("timeout exceeded")
+		}
+		// Abruptly close the connection.
+		(<-closeFirst).conn.eio.Close()
+
+		select {
+		case name := <-connectedWith:
+			require.Equal(t, "websocket", name)
+		case <-time.After(defaultTestWaitTimeout):
+			t.Fatal("timeout exceeded")
+		}
+	})
+
+	t.Run("should refresh the headers and the query with `RequestHeaderFunc` and `QueryFunc` on reconnection", func(t *testing.T) {
+		var attempt atomic.Int32
+		server, _, manager := newTestServerAndClient(
+			t,
+			nil,
+			&ManagerConfig{
+				EIO: eio.ClientConfig{
+					Transports: []string{"websocket"},
+					RequestHeaderFunc: func() (http.Header, error) {
+						return http.Header{"Authorization": {fmt.Sprintf("Bearer %d", attempt.Load())}}, nil
+					},
+					QueryFunc: func() (url.Values, error) {
+						return url.Values{"token": {fmt.Sprint(attempt.Add(1))}}, nil
+					},
+				},
+			},
+		)
+		socket := manager.Socket("/", nil)
+		type credentials struct{ header, query string }
+		connectedWith := make(chan credentials, 2)
+		closeFirst := make(chan *serverSocket, 1)
+
+		server.OnConnection(func(socket ServerSocket) {
+			s := socket.(*serverSocket)
+			connectedWith <- credentials{
+				header: socket.Handshake().Headers.Get("Authorization"),
+				query:  socket.Handshake().Query.Get("token"),
+			}
+			select {
+			case closeFirst <- s:
+			default:
+			}
+		})
+		socket.Connect()
+		defer socket.Disconnect()
+
+		require.Equal(t, credentials{"Bearer 1", "1"}, <-connectedWith)
+		// Abruptly close the connection.
+		(<-closeFirst).conn.eio.Close()
+
+		select {
+		case c := <-connectedWith:
+			require.Equal(t, credentials{"Bearer 2", "2"}, c)
+		case <-time.After(defaultTestWaitTimeout):
+			t.Fatal("timeout exceeded")
+		}
+	})
+
 	t.Run("should reconnect manually", func(t *testing.T) {
 		_, _, manager := newTestServerAndClient(
 			t,
@@ -198,4 +302,146 @@ func TestClient(t *testing.T) {
 		})
 		tw.WaitTimeout(t, defaultTestWaitTimeout)
 	})
+
+	t.Run("should receive the server error if the handshake is rejected", func(t *testing.T) {
+		_, _, manager := newTestServerAndClient(
+			t,
+			&ServerConfig{
+				EIO: eio.ServerConfig{
+					AuthenticatorWithError: func(w http.ResponseWriter, r *http.Request) error {
+						return &eio.ServerError{Code: 4001, Message: "Banned", Context: map[string]any{"reason": "spam"}}
+					},
+				},
+			},
+			&ManagerConfig{
+				EIO:            eio.ClientConfig{Transports: []string{"polling", "websocket"}},
+				NoReconnection: true,
+			},
+		)
+		manager.OffAll()
+		socket := manager.Socket("/", nil)
+		socket.OffAll()
+		tw := newTestWaiter(2)
+
+		check := func(err error) {
+			var se *eio.ServerError
+			require.ErrorAs(t, err, &se)
+			assert.Equal(t, 4001, se.Code)
+			assert.Equal(t, "Banned", se.Message)
+			assert.Equal(t, map[string]any{"reason": "spam"}, se.Context)
+		}
+		manager.OnError(func(err error) {
+			defer tw.Done()
+			check(err)
+		})
+		socket.OnConnectError(func(err error) {
+			defer tw.Done()
+			check(err)
+		})
+		socket.Connect()
+
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
+
+	t.Run("`ConnectContext` should return after the socket is connected", func(t *testing.T) {
+		server, _, manager := newTestServerAndClient(t, nil, nil)
+		server.OnConnection(func(socket ServerSocket) {})
+		socket := manager.Socket("/", nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTestWaitTimeout)
+		defer cancel()
+		err := socket.ConnectContext(ctx)
+		require.NoError(t, err)
+		require.True(t, socket.Connected())
+
+		// Should return immediately if the socket is already connected.
+		err = socket.ConnectContext(ctx)
+		require.NoError(t, err)
+		socket.Disconnect()
+	})
+
+	t.Run("`ConnectContext` should return the CONNECT_ERROR of the server", func(t *testing.T) {
+		server, _, manager := newTestServerAndClient(t, nil, nil)
+		server.Use(func(socket ServerSocket, handshake *Handshake) error {
+			return fmt.Errorf("not authorized")
+		})
+		socket := manager.Socket("/", nil)
+		socket.OffAll()
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTestWaitTimeout)
+		defer cancel()
+		err := socket.ConnectContext(ctx)
+		require.EqualError(t, err, "sio: not authorized")
+		require.False(t, socket.Connected())
+
+		var connectErr *ConnectError
+		require.ErrorAs(t, err, &connectErr)
+		assert.Equal(t, "not authorized", connectErr.Message)
+	})
+
+	t.Run("`ConnectContext` should return when the context is done", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer s.Close()
+		manager := NewManager(s.URL, &ManagerConfig{
+			EIO: eio.ClientConfig{Transports: []string{"polling"}},
+		})
+		socket := manager.Socket("/", nil)
+
+		var attempts atomic.Int32
+		manager.OnReconnectAttempt(func(attempt uint32) {
+			attempts.Add(1)
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := socket.ConnectContext(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(start), defaultTestWaitTimeout)
+		require.False(t, socket.Active())
+
+		// The reconnection attempts should be stopped.
+		time.Sleep(2 * DefaultReconnectionDelay)
+		require.Zero(t, attempts.Load())
+		// The next connection should be able to reconnect automatically.
+		require.Zero(t, manager.backoff.attempts())
+	})
+
+	t.Run("should reconnect if the transport is closed by the fault injection", func(t *testing.T) {
+		var closed atomic.Bool
+		_, _, manager := newTestServerAndClient(
+			t,
+			&ServerConfig{
+				AcceptAnyNamespace: true,
+			},
+			&ManagerConfig{
+				EIO: eio.ClientConfig{
+					Transports: []string{"websocket"},
+					FaultInjection: &eio.FaultInjectionConfig{
+						Schedule: func(transportName string, n int, packet *eioparser.Packet) eio.Fault {
+							if bytes.Contains(packet.Data, []byte("close me")) && closed.CompareAndSwap(false, true) {
+								return eio.FaultClose
+							}
+							return eio.FaultNone
+						},
+					},
+				},
+			},
+		)
+		tw := newTestWaiter(1)
+		socket := manager.Socket("/", nil)
+
+		socket.OnceConnect(func() {
+			socket.Emit("close me")
+		})
+		manager.OnReconnect(func(attempt uint32) {
+			socket.Disconnect()
+			tw.Done()
+		})
+		socket.Connect()
+
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
 }
@@ -7,14 +7,15 @@ import (
 
 type (
 	Emitter struct {
-		socket   emitter
-		timeout  time.Duration
-		volatile bool
+		socket     emitter
+		timeout    time.Duration
+		volatile   bool
+		noCompress bool
 	}
 
 	emitter interface {
 		Socket
-		emit(eventName string, timeout time.Duration, volatile, fromQueue bool, v ...any)
+		emit(eventName string, timeout time.Duration, volatile, compress, fromQueue bool, v ...any)
 	}
 )
 
@@ -31,7 +32,7 @@ func (e *Emitter) Emit(eventName string, v ...any) {
 			}
 		}
 	}
-	e.socket.emit(eventName, e.timeout, e.volatile, false, v...)
+	e.socket.emit(eventName, e.timeout, e.volatile, !e.noCompress, false, v...)
 }
 
 func (e Emitter) Timeout(timeout time.Duration) Emitter {
@@ -43,3 +44,8 @@ func (e Emitter) Volatile() Emitter {
 	e.volatile = true
 	return e
 }
+
+func (e Emitter) Compress(compress bool) Emitter {
+	e.noCompress = !compress
+	return e
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
+	"net/http"
 
 	"github.com/tomruk/socket.io-go/internal/sync"
 )
@@ -44,9 +45,9 @@ func GenerateBase64ID(size int) (string, error) {
 	return encoded, nil
 }
 
-func (s *Server) generateSID() (sid string, err error) {
+func (s *Server) generateSID(r *http.Request) (sid string, err error) {
 	for i := 0; ; i++ {
-		sid, err = GenerateBase64ID(Base64IDSize)
+		sid, err = s.idGenerator(r)
 		if err != nil {
 			return "", err
 		}
@@ -1,19 +1,34 @@
 package eio
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"time"
 
 	"github.com/quic-go/webtransport-go"
 	"github.com/tomruk/socket.io-go/engine.io/transport"
+	"github.com/tomruk/socket.io-go/engine.io/transport/memory"
+	"github.com/tomruk/socket.io-go/internal/sync"
 	"nhooyr.io/websocket"
 )
 
+type (
+	// Dial a network connection. See net.Dialer.DialContext.
+	ClientDialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Return the URL of the proxy to use for the request. See http.Transport.Proxy.
+	ClientProxyFunc func(r *http.Request) (*url.URL, error)
+)
+
 type ClientConfig struct {
-	// Valid transports are: polling, websocket.
+	// Valid transports are: polling, websocket, webtransport, memory
+	// and the transports registered with RegisterClientTransport.
 	//
-	// Default value is: ["polling", "websocket"]
+	// Default value is: ["polling", "webtransport", "websocket"]
+	// If the URL scheme is memory (e.g. memory://name), the default value is: ["memory"]
 	Transports []string
 
 	// Timeout for transport upgrade.
@@ -23,33 +38,155 @@ type ClientConfig struct {
 	// Additional callback to get notified about the transport upgrade.
 	UpgradeDone func(transportName string)
 
+	// If this is true and the transports in Transports fail to connect, the rest of the built-in transports
+	// are tried in the following order: webtransport, websocket, polling.
+	// Only the transports that come after a failed transport are tried. For example,
+	// if Transports is ["websocket"], polling is tried; if it is ["webtransport"], websocket and polling are tried.
+	//
+	// Use this to connect on the networks where some of the transports are blocked (e.g. by a proxy).
+	TryAllTransports bool
+
+	// Additional callback to get notified about a transport that failed to connect.
+	// This is called for every failed transport before the next one is tried.
+	TransportFailed func(transportName string, err error)
+
+	// If this is true, once an upgrade (e.g. to websocket) succeeds, the subsequent connections
+	// connect directly with the transport that is upgraded to, skipping polling.
+	// If the direct connection fails, the transports in Transports are tried as usual.
+	//
+	// The transport is remembered in the RememberedUpgrade passed to DialRememberingUpgrade.
+	// Dial and DialContext don't remember the transport.
+	// The sio.Manager remembers the transport across its (re)connections.
+	//
+	// This is the equivalent of `rememberUpgrade` in original Engine.IO.
+	RememberUpgrade bool
+
 	// This is a special data type to concurrently
 	// store the additional HTTP request headers to use.
 	// Values can be retrieved and changed at any time with Get, Set, Del methods.
 	// Create this with transport.NewRequestHeader function.
 	RequestHeader *transport.RequestHeader
 
+	// Called before every request (handshakes, polls and upgrades) to get additional HTTP request headers.
+	// The returned headers replace the ones in RequestHeader with the same keys.
+	// Use this for the headers that must be recomputed on every (re)connection, such as short-lived access tokens.
+	//
+	// If an error is returned, the request is not made and the transport fails.
+	RequestHeaderFunc transport.RequestHeaderFunc
+
+	// Path of the Engine.IO server (e.g. /socket.io/). If this is set, it replaces the path of the URL.
+	//
+	// Default: the path of the URL
+	Path string
+
+	// Additional query parameters to add to the URL.
+	// The parameters replace the ones in the URL with the same keys.
+	Query url.Values
+
+	// Called before every request (handshakes, polls and upgrades) to get additional query parameters.
+	// The returned parameters replace the ones in the URL and in Query with the same keys.
+	//
+	// If an error is returned, the request is not made and the transport fails.
+	QueryFunc transport.QueryFunc
+
+	// Maximum size of the packets received from the server with the polling and websocket transports.
+	// The handshake response is not limited.
+	// This also limits the size of a polling payload (the packets received with a single poll).
+	//
+	// Default: 0 (unlimited for polling, the default read limit of the websocket package for websocket)
+	MaxBufferSize int64
+
 	// Custom HTTP transport to use.
 	//
 	// If this is a http.Transport it will be cloned and timeout(s) will be set later on.
 	// If not, it is the user's responsibility to set a proper timeout so when polling takes too long, we don't fail.
 	HTTPTransport http.RoundTripper
 
+	// Function to dial the network connections of the transports.
+	// Leave it nil to use the default dialer.
+	//
+	// The webtransport transport runs over QUIC, and dials the "udp" network ("unixgram" for unix URLs).
+	// The connection it gets must be a connected datagram connection (e.g. a *net.UDPConn).
+	// If this is set, WebTransportDialer.DialAddr must be nil.
+	//
+	// HTTPTransport (and the HTTP client of WebSocketDialOptions, if it is set) must be a *http.Transport.
+	DialContext ClientDialContextFunc
+
+	// Proxy to use for the polling and websocket transports. HTTP, HTTPS and SOCKS5 proxies are supported.
+	// Use http.ProxyURL to always use the same proxy.
+	// Leave it nil to use the proxy from the environment variables (see http.ProxyFromEnvironment).
+	//
+	// The webtransport transport runs over QUIC and cannot be used through a proxy.
+	// If a proxy is returned for the URL of the webtransport transport, the transport fails.
+	//
+	// HTTPTransport (and the HTTP client of WebSocketDialOptions, if it is set) must be a *http.Transport.
+	Proxy ClientProxyFunc
+
+	// Cookie jar to use for the polling and websocket requests.
+	// Set this to send back the cookies set by the server (e.g. the sticky-session cookie, see: ServerConfig.Cookie).
+	// A cookie jar can be created with the net/http/cookiejar package.
+	//
+	// If this is nil, cookies are ignored.
+	CookieJar http.CookieJar
+
 	// Custom WebTransport dialer to use
 	WebTransportDialer *webtransport.Dialer
 
 	// Custom WebSocket dialer to use
 	WebSocketDialOptions *websocket.DialOptions
 
+	// Enable the permessage-deflate extension of the websocket transport.
+	// Leave it nil to disable compression.
+	PerMessageDeflate *PerMessageDeflateConfig
+
+	// Inject faults (latency, packet drop, etc.) into the packets sent to the server.
+	// This is meant to be used for testing. Leave it nil to disable fault injection.
+	FaultInjection *FaultInjectionConfig
+
 	// For debugging purposes. Leave it nil if it is of no use.
 	Debugger Debugger
 }
 
+// Connect to an Engine.IO server.
+//
+// The scheme of rawURL can be http, https, ws, wss, memory (see the transport/memory package) or unix.
+// A unix URL consists of the path of the Unix domain socket and the HTTP path, separated by the first colon.
+// For example: unix:///var/run/app.sock:/engine.io/
+// A colon in the path of the socket must be percent-encoded as %3A.
 func Dial(rawURL string, callbacks *Callbacks, config *ClientConfig) (ClientSocket, error) {
-	return dial(rawURL, callbacks, config, false)
+	return dial(context.Background(), rawURL, callbacks, config, nil, false)
+}
+
+// Connect to an Engine.IO server. See Dial.
+//
+// ctx bounds the connection (the handshake). If ctx is done before the connection is established,
+// ctx.Err() is returned. Once the connection is established, ctx has no effect.
+func DialContext(ctx context.Context, rawURL string, callbacks *Callbacks, config *ClientConfig) (ClientSocket, error) {
+	return dial(ctx, rawURL, callbacks, config, nil, false)
+}
+
+// Connect to an Engine.IO server. See DialContext.
+//
+// If config.RememberUpgrade is set, the transport remembered in r is tried first,
+// and r is updated when an upgrade succeeds.
+func DialRememberingUpgrade(
+	ctx context.Context,
+	rawURL string,
+	callbacks *Callbacks,
+	config *ClientConfig,
+	r *RememberedUpgrade,
+) (ClientSocket, error) {
+	return dial(ctx, rawURL, callbacks, config, r, false)
 }
 
-func dial(rawURL string, callbacks *Callbacks, config *ClientConfig, testWaitUpgrade bool) (ClientSocket, error) {
+func dial(
+	ctx context.Context,
+	rawURL string,
+	callbacks *Callbacks,
+	config *ClientConfig,
+	rememberedUpgrade *RememberedUpgrade,
+	testWaitUpgrade bool,
+) (ClientSocket, error) {
 	if callbacks == nil {
 		callbacks = new(Callbacks)
 	}
@@ -60,32 +197,57 @@ func dial(rawURL string, callbacks *Callbacks, config *ClientConfig, testWaitUpg
 	}
 
 	socket := &clientSocket{
-		httpClient: newHTTPClient(config.HTTPTransport),
-
-		upgradeTimeout: defaultUpgradeTimeout,
-		upgradeDone:    config.UpgradeDone,
+		upgradeTimeout:  defaultUpgradeTimeout,
+		upgradeDone:     config.UpgradeDone,
+		transportFailed: config.TransportFailed,
 
 		callbacks: *callbacks,
+		stats:     newSocketStats(),
 
 		pingChan:  make(chan struct{}, 1),
 		closeChan: make(chan struct{}),
 
+		faultInjector: newFaultInjector(config.FaultInjection),
+		maxBufferSize: config.MaxBufferSize,
+
 		testWaitUpgrade: testWaitUpgrade,
 	}
 
-	if config.RequestHeader != nil {
-		socket.requestHeader = config.RequestHeader
-	} else {
-		socket.requestHeader = transport.NewRequestHeader(nil)
+	socket.requestOptions = &transport.RequestOptions{
+		Header:     config.RequestHeader,
+		HeaderFunc: config.RequestHeaderFunc,
+		QueryFunc:  config.QueryFunc,
+	}
+	if socket.requestOptions.Header == nil {
+		socket.requestOptions.Header = transport.NewRequestHeader(nil)
+	}
+
+	u, socketPath, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	setPathAndQuery(u, config.Path, config.Query)
+	socket.url = u
+	socket.dialer = newClientDialer(config, socketPath)
+
+	socket.httpClient, err = newHTTPClient(config.HTTPTransport, socket.dialer)
+	if err != nil {
+		return nil, err
 	}
 
 	var transports []string
 	if len(config.Transports) > 0 {
 		transports = config.Transports
+	} else if socket.url.Scheme == memory.Scheme {
+		transports = []string{"memory"}
 	} else {
 		transports = []string{"polling", "webtransport", "websocket"}
 	}
 
+	if config.TryAllTransports {
+		transports = withFallbackTransports(transports)
+	}
+
 	if config.UpgradeTimeout != 0 {
 		socket.upgradeTimeout = config.UpgradeTimeout
 	}
@@ -94,18 +256,41 @@ func dial(rawURL string, callbacks *Callbacks, config *ClientConfig, testWaitUpg
 		socket.upgradeDone = func(transportName string) {}
 	}
 
+	if socket.transportFailed == nil {
+		socket.transportFailed = func(transportName string, err error) {}
+	}
+
 	if config.WebTransportDialer != nil {
 		socket.webTransportDialer = config.WebTransportDialer
 	} else {
 		socket.webTransportDialer = &webtransport.Dialer{}
 	}
 
+	socket.webTransportDialer, err = socket.dialer.webTransportDialer(socket.webTransportDialer)
+	if err != nil {
+		return nil, err
+	}
+
 	if config.WebSocketDialOptions != nil {
 		socket.wsDialOptions = config.WebSocketDialOptions
 	} else {
 		socket.wsDialOptions = &websocket.DialOptions{}
 	}
 
+	socket.wsDialOptions, err = socket.dialer.wsDialOptions(socket.wsDialOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PerMessageDeflate != nil {
+		socket.wsDialOptions = config.PerMessageDeflate.dialOptions(socket.wsDialOptions)
+	}
+
+	if config.CookieJar != nil {
+		socket.httpClient.Jar = config.CookieJar
+		socket.wsDialOptions = dialOptionsWithCookieJar(socket.wsDialOptions, config.CookieJar)
+	}
+
 	if config.Debugger != nil {
 		socket.debug = config.Debugger
 	} else {
@@ -119,22 +304,82 @@ func dial(rawURL string, callbacks *Callbacks, config *ClientConfig, testWaitUpg
 		return id
 	})
 
-	var err error
-	socket.url, err = parseURL(rawURL)
-	if err != nil {
-		return nil, err
+	if config.RememberUpgrade && rememberedUpgrade != nil {
+		socket.rememberedUpgrade = rememberedUpgrade
+		name := rememberedUpgrade.TransportName()
+		if name != "" && findTransport(transports, name) {
+			socket.debug.Log("Connecting with the remembered transport", name)
+			err = socket.connect(ctx, []string{name})
+			if err == nil {
+				return socket, nil
+			}
+			socket.debug.Log("Connection with the remembered transport failed", err)
+			socket.rememberedUpgrade.set("")
+			if ctx.Err() != nil {
+				return nil, err
+			}
+		}
 	}
-	err = socket.connect(transports)
+
+	err = socket.connect(ctx, transports)
 	if err != nil {
 		return nil, err
 	}
 	return socket, nil
 }
 
-func parseURL(rawURL string) (*url.URL, error) {
+// The order in which the transports are tried if ClientConfig.TryAllTransports is set.
+var fallbackTransports = []string{"webtransport", "websocket", "polling"}
+
+// Append the transports that come after the given transports in fallbackTransports.
+func withFallbackTransports(transports []string) []string {
+	result := slices.Clone(transports)
+	for _, name := range transports {
+		i := slices.Index(fallbackTransports, name)
+		if i == -1 {
+			continue
+		}
+		for _, fallback := range fallbackTransports[i+1:] {
+			if !slices.Contains(result, fallback) {
+				result = append(result, fallback)
+			}
+		}
+	}
+	return result
+}
+
+// The transport of the last successful upgrade. See ClientConfig.RememberUpgrade.
+// The zero value is ready to use.
+type RememberedUpgrade struct {
+	name string
+	mu   sync.Mutex
+}
+
+// Name of the remembered transport. Empty if no transport is remembered.
+func (r *RememberedUpgrade) TransportName() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.name
+}
+
+func (r *RememberedUpgrade) set(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.name = name
+}
+
+// socketPath is the path of the Unix domain socket if the URL is a unix URL. See unixScheme.
+func parseURL(rawURL string) (u *url.URL, socketPath string, err error) {
 	url, err := url.Parse(rawURL)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	if url.Scheme == unixScheme {
+		url, socketPath, err = parseUnixURL(url)
+		if err != nil {
+			return nil, "", err
+		}
 	}
 
 	if len(url.Path) > 0 && url.Path[len(url.Path)-1] != '/' {
@@ -147,28 +392,51 @@ func parseURL(rawURL string) (*url.URL, error) {
 	case "ws":
 		url.Scheme = "http"
 	}
-	return url, nil
+	return url, socketPath, nil
 }
 
-func newHTTPClient(t http.RoundTripper) *http.Client {
-	// Clone the transport, so that we don't change the default timeouts later on. See: polling/client.go
-	// If we're unable to clone the transport, leave it as it is.
-	if t == nil {
-		ht, ok := http.DefaultTransport.(*http.Transport)
-		if ok {
-			t = ht.Clone()
-		} else {
-			t = http.DefaultTransport
+// Replace the path of u with path (if it is not empty) and add the query parameters to u.
+func setPathAndQuery(u *url.URL, path string, query url.Values) {
+	if path != "" {
+		if path[0] != '/' {
+			path = "/" + path
 		}
-	} else {
-		ht, ok := t.(*http.Transport)
-		if ok {
-			t = ht.Clone()
+		if path[len(path)-1] != '/' {
+			path += "/"
+		}
+		u.Path = path
+		u.RawPath = ""
+	}
+	if len(query) > 0 {
+		q := u.Query()
+		for k, v := range query {
+			q[k] = v
 		}
+		u.RawQuery = q.Encode()
 	}
+}
 
+// Return a copy of the options with an HTTP client that uses the cookie jar.
+// If the HTTP client of the options already has a cookie jar, it is left as it is.
+func dialOptionsWithCookieJar(options *websocket.DialOptions, jar http.CookieJar) *websocket.DialOptions {
+	o := *options
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Jar: jar}
+	} else if o.HTTPClient.Jar == nil {
+		c := *o.HTTPClient
+		c.Jar = jar
+		o.HTTPClient = &c
+	}
+	return &o
+}
+
+func newHTTPClient(t http.RoundTripper, dialer *clientDialer) (*http.Client, error) {
+	t, err := dialer.httpTransport(t)
+	if err != nil {
+		return nil, err
+	}
 	return &http.Client{
 		Transport: t,
 		Timeout:   0,
-	}
+	}, nil
 }
@@ -1,6 +1,7 @@
 package eio
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -13,9 +14,6 @@ import (
 
 	"github.com/tomruk/socket.io-go/engine.io/parser"
 	"github.com/tomruk/socket.io-go/engine.io/transport"
-	"github.com/tomruk/socket.io-go/engine.io/transport/polling"
-	"github.com/tomruk/socket.io-go/engine.io/transport/websocket"
-	"github.com/tomruk/socket.io-go/engine.io/transport/webtransport"
 )
 
 var errUpgradeTimeoutExceeded = fmt.Errorf("upgradeTimeout exceeded")
@@ -26,14 +24,15 @@ type clientSocket struct {
 
 	url *url.URL
 
-	upgradeTimeout time.Duration
-	upgradeDone    func(transportName string)
+	upgradeTimeout  time.Duration
+	upgradeDone     func(transportName string)
+	transportFailed func(transportName string, err error)
 
 	// HTTP client to use on transports.
 	httpClient *http.Client
 
 	// HTTP headers to use on transports.
-	requestHeader *transport.RequestHeader
+	requestOptions *transport.RequestOptions
 
 	// WebTransport dialer to use on transports
 	webTransportDialer *_webtransport.Dialer
@@ -41,6 +40,16 @@ type clientSocket struct {
 	// WebSocket dialer to use on transports
 	wsDialOptions *_websocket.DialOptions
 
+	// Network configuration of the polling and websocket transports.
+	dialer *clientDialer
+
+	// Can be nil.
+	faultInjector *faultInjector
+	maxBufferSize int64
+
+	// Can be nil. See ClientConfig.RememberUpgrade.
+	rememberedUpgrade *RememberedUpgrade
+
 	// These are set after the handshake.
 	sid          string
 	upgrades     []string
@@ -49,6 +58,7 @@ type clientSocket struct {
 	maxPayload   int64
 
 	callbacks Callbacks
+	stats     *socketStats
 
 	pingChan chan struct{}
 
@@ -59,52 +69,43 @@ type clientSocket struct {
 	debug           Debugger
 }
 
-func (s *clientSocket) connect(transports []string) (err error) {
+func (s *clientSocket) connect(ctx context.Context, transports []string) (err error) {
 	s.transportMu.Lock()
 	defer s.transportMu.Unlock()
 
 	for _, name := range transports {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
 		transports = transports[1:]
 		c := transport.NewCallbacks()
 
-		switch name {
-		case "polling":
-			s.transport = polling.NewClientTransport(
-				c,
-				ProtocolVersion,
-				*s.url,
-				s.requestHeader,
-				s.httpClient,
-			)
-		case "websocket":
-			s.transport = websocket.NewClientTransport(
-				c,
-				"",
-				ProtocolVersion,
-				*s.url,
-				s.requestHeader,
-				s.wsDialOptions,
-			)
-		case "webtransport":
-			s.transport = webtransport.NewClientTransport(
-				c,
-				"",
-				ProtocolVersion,
-				*s.url,
-				s.requestHeader,
-				s.webTransportDialer,
-			)
-		default:
+		if _, ok := getClientTransport(name); !ok {
 			err = fmt.Errorf("eio: invalid transport name: %s", name)
 			return
 		}
+		var t ClientTransport
+		t, err = s.newTransport(name, c, "")
+		if err != nil {
+			s.debug.Log("Transport couldn't be created", err)
+			s.transportFailed(name, err)
+			continue
+		}
+		s.transport = t
 		s.debug.Log("Transport is set to", name)
 		c.Set(s.onPacket, s.onTransportClose)
+		c.SetOnSent(s.stats.onSend)
 
 		var hr *parser.HandshakeResponse
-		hr, err = s.transport.Handshake()
+		hr, err = s.transport.Handshake(ctx)
 		if err != nil {
 			s.debug.Log("Handshake failed", err)
+			s.transportFailed(name, serverErrorFromHandshake(err))
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				break
+			}
 			continue
 		}
 		s.sid = hr.SID
@@ -122,6 +123,8 @@ func (s *clientSocket) connect(transports []string) (err error) {
 	if err == nil {
 		go s.maybeUpgrade(transports, s.upgrades)
 		go s.handleTimeout()
+	} else {
+		err = serverErrorFromHandshake(err)
 	}
 	return
 }
@@ -134,6 +137,8 @@ func (s *clientSocket) PingInterval() time.Duration { return s.pingInterval }
 
 func (s *clientSocket) PingTimeout() time.Duration { return s.pingTimeout }
 
+func (s *clientSocket) Stats() SocketStats { return s.stats.get(s.TransportName()) }
+
 func (s *clientSocket) handleTimeout() {
 	for {
 		timeout := s.pingInterval + s.pingTimeout
@@ -153,17 +158,19 @@ func (s *clientSocket) handleTimeout() {
 }
 
 func (s *clientSocket) maybeUpgrade(transports []string, upgrades []string) {
-	if s.TransportName() == "webtransport" {
-		s.debug.Log("maybeUpgrade", "current transport is webtransport. already upgraded")
-		return
-	} else if s.TransportName() == "websocket" && !findTransport(upgrades, "webtransport") {
-		s.debug.Log("maybeUpgrade", "current transport is websocket, and there are no further upgrades. already upgraded")
+	if len(upgrades) == 0 {
+		s.debug.Log("maybeUpgrade", "there are no upgrades in handshake received from server. current transport is", s.TransportName())
 		return
-	} else if !findTransport(upgrades, "websocket") && !findTransport(upgrades, "webtransport") {
-		s.debug.Log("maybeUpgrade", "couldn't find 'websocket' and 'webtransport' in handshake received from server")
-		return
-	} else if !findTransport(transports, "websocket") && !findTransport(transports, "webtransport") {
-		s.debug.Log("maybeUpgrade", "couldn't find 'websocket' and 'webtransport' in `Transports` configuration option")
+	}
+	canUpgrade := false
+	for _, name := range transports {
+		if findTransport(upgrades, name) {
+			canUpgrade = true
+			break
+		}
+	}
+	if !canUpgrade {
+		s.debug.Log("maybeUpgrade", "none of the upgrades received from server", upgrades, "are in `Transports` configuration option")
 		return
 	}
 
@@ -182,20 +189,13 @@ func (s *clientSocket) maybeUpgrade(transports []string, upgrades []string) {
 			s.debug.Log("skip", upgradeTo)
 			continue
 		}
-		var (
-			t ClientTransport
-			c = transport.NewCallbacks()
-		)
-		switch upgradeTo {
-		case "websocket":
-			s.debug.Log("maybeUpgrade", "upgrading from", s.TransportName(), "to websocket")
-			t = websocket.NewClientTransport(c, s.sid, ProtocolVersion, *s.url, s.requestHeader, s.wsDialOptions)
-		case "webtransport":
-			s.debug.Log("maybeUpgrade", "upgrading from", s.TransportName(), "to webtransport")
-			t = webtransport.NewClientTransport(c, s.sid, ProtocolVersion, *s.url, s.requestHeader, s.webTransportDialer)
-		default:
-			s.debug.Log("skip", upgradeTo)
+		c := transport.NewCallbacks()
+		t, err := s.newTransport(upgradeTo, c, s.sid)
+		if err != nil {
+			s.debug.Log("skip", upgradeTo, err)
+			continue
 		}
+		s.debug.Log("maybeUpgrade", "upgrading from", s.TransportName(), "to", upgradeTo)
 		if s.tryUpgradeTo(t, c) {
 			return
 		}
@@ -232,7 +232,7 @@ func (s *clientSocket) tryUpgradeTo(t ClientTransport, c *transport.Callbacks) (
 		}
 	}, nil)
 
-	_, err := t.Handshake()
+	_, err := t.Handshake(context.Background())
 	if err != nil {
 		t.Close()
 		s.onError(fmt.Errorf("eio: upgrade failed: %w", err))
@@ -270,6 +270,7 @@ func (s *clientSocket) finishUpgradeTo(t ClientTransport, c *transport.Callbacks
 	}
 
 	c.Set(s.onPacket, s.onTransportClose)
+	c.SetOnSent(s.stats.onSend)
 
 	s.transportMu.Lock()
 	defer s.transportMu.Unlock()
@@ -278,9 +279,13 @@ func (s *clientSocket) finishUpgradeTo(t ClientTransport, c *transport.Callbacks
 	s.transport = t
 
 	old.Discard()
+	s.stats.onUpgrade()
 
 	t.Send(p)
 	s.debug.Log("upgradeTo", "upgraded to", t.Name())
+	if s.rememberedUpgrade != nil {
+		s.rememberedUpgrade.set(t.Name())
+	}
 	// Don't block
 	go s.upgradeDone(t.Name())
 }
@@ -295,6 +300,7 @@ func findTransport(transports []string, name string) bool {
 }
 
 func (s *clientSocket) onPacket(packets ...*parser.Packet) {
+	s.stats.onReceive(packets...)
 	s.callbacks.OnPacket(packets...)
 	for _, packet := range packets {
 		s.handlePacket(packet)
@@ -308,6 +314,7 @@ func (s *clientSocket) handlePacket(packet *parser.Packet) {
 		case s.pingChan <- struct{}{}:
 		default:
 		}
+		s.stats.onPing(s.pingInterval)
 
 		pong, err := parser.NewPacket(parser.PacketTypePong, false, packet.Data)
 		if err != nil {
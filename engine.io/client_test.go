@@ -2,19 +2,35 @@ package eio
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tomruk/socket.io-go/engine.io/parser"
+	"github.com/tomruk/socket.io-go/engine.io/transport/memory"
+	"github.com/tomruk/socket.io-go/internal/sync"
 )
 
 type testDialOptions struct {
-	testWaitUpgrade bool
+	testWaitUpgrade   bool
+	rememberedUpgrade *RememberedUpgrade
 }
 
 func testDial(t *testing.T, rawURL string, callbacks *Callbacks, config *ClientConfig, options *testDialOptions) *clientSocket {
@@ -27,7 +43,7 @@ func testDial(t *testing.T, rawURL string, callbacks *Callbacks, config *ClientC
 	if os.Getenv("EIO_DEBUGGER_PRINT") == "1" {
 		config.Debugger = NewPrintDebugger()
 	}
-	s, err := dial(rawURL, callbacks, config, options.testWaitUpgrade)
+	s, err := dial(context.Background(), rawURL, callbacks, config, options.rememberedUpgrade, options.testWaitUpgrade)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -72,6 +88,10 @@ func createTestPackets(t *testing.T) []*parser.Packet {
 }
 
 func testSendReceive(t *testing.T, transports []string) {
+	testSendReceiveWithConfig(t, nil, &ClientConfig{Transports: transports})
+}
+
+func testSendReceiveWithConfig(t *testing.T, serverConfig *ServerConfig, clientConfig *ClientConfig) {
 	tw := NewTestWaiter(0)
 	test := createTestPackets(t)
 
@@ -86,7 +106,7 @@ func testSendReceive(t *testing.T, transports []string) {
 		return false
 	}
 
-	send := func(socket ServerSocket) {
+	send := func(socket Socket) {
 		for _, p := range test {
 			if p.Type == parser.PacketTypeMessage {
 				socket.Send(p)
@@ -126,7 +146,7 @@ func testSendReceive(t *testing.T, transports []string) {
 		return callbacks
 	}
 
-	io := newTestServer(onSocket, nil, nil)
+	io := newTestServer(onSocket, serverConfig, nil)
 	err := io.Run()
 	if err != nil {
 		t.Fatal(err)
@@ -151,7 +171,7 @@ func testSendReceive(t *testing.T, transports []string) {
 		},
 	}
 
-	socket := testDial(t, s.URL, callbacks, &ClientConfig{Transports: transports}, nil)
+	socket := testDial(t, s.URL, callbacks, clientConfig, nil)
 	send(socket)
 
 	tw.WaitTimeout(t, DefaultTestWaitTimeout)
@@ -169,6 +189,23 @@ func TestCommon(t *testing.T) {
 	t.Run("should send and receive with transport set to polling and websocket", func(t *testing.T) {
 		testSendReceive(t, []string{"polling", "websocket"})
 	})
+
+	t.Run("should send and receive with permessage-deflate enabled", func(t *testing.T) {
+		perMessageDeflate := &PerMessageDeflateConfig{Threshold: 2}
+		testSendReceiveWithConfig(
+			t,
+			&ServerConfig{PerMessageDeflate: perMessageDeflate},
+			&ClientConfig{Transports: []string{"websocket"}, PerMessageDeflate: perMessageDeflate},
+		)
+	})
+
+	t.Run("should send and receive with HTTP compression enabled", func(t *testing.T) {
+		testSendReceiveWithConfig(
+			t,
+			&ServerConfig{HTTPCompression: &HTTPCompressionConfig{Threshold: 1}},
+			&ClientConfig{Transports: []string{"polling"}},
+		)
+	})
 }
 
 func TestClient(t *testing.T) {
@@ -359,6 +396,304 @@ func TestClient(t *testing.T) {
 		tw.WaitTimeout(t, DefaultTestWaitTimeout)
 	})
 
+	t.Run("should connect directly with the transport that is upgraded to if `RememberUpgrade` is set", func(t *testing.T) {
+		connectedWith := make(chan string, 3)
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			connectedWith <- socket.TransportName()
+			return nil
+		}, nil, nil)
+		err := io.Run()
+		require.NoError(t, err)
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		tw := NewTestWaiter(1)
+		config := &ClientConfig{
+			Transports:      []string{"polling", "websocket"},
+			RememberUpgrade: true,
+			UpgradeDone: func(transportName string) {
+				tw.Done()
+			},
+		}
+
+		options := &testDialOptions{rememberedUpgrade: new(RememberedUpgrade)}
+		socket := testDial(t, s.URL, nil, config, options)
+		require.Equal(t, "polling", <-connectedWith)
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+		require.Equal(t, "websocket", socket.TransportName())
+		socket.Close()
+
+		socket = testDial(t, s.URL, nil, config, options)
+		require.Equal(t, "websocket", <-connectedWith)
+		require.Equal(t, "websocket", socket.TransportName())
+		socket.Close()
+
+		// Without a RememberedUpgrade, nothing should be remembered.
+		socket = testDial(t, s.URL, nil, config, nil)
+		require.Equal(t, "polling", <-connectedWith)
+		socket.Close()
+
+		// If the direct connection fails, the transports should be tried as usual.
+		pollingOnly := newTestServer(func(socket ServerSocket) *Callbacks {
+			connectedWith <- socket.TransportName()
+			return nil
+		}, &ServerConfig{Transports: []string{"polling"}}, nil)
+		err = pollingOnly.Run()
+		require.NoError(t, err)
+		s2 := httptest.NewServer(pollingOnly)
+		defer s2.Close()
+
+		socket = testDial(t, s2.URL, nil, config, options)
+		require.Equal(t, "polling", <-connectedWith)
+		require.Equal(t, "polling", socket.TransportName())
+		require.Empty(t, options.rememberedUpgrade.TransportName())
+		socket.Close()
+	})
+
+	t.Run("should use the transports registered with `RegisterClientTransport`", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+		created := make(chan *ClientTransportOptions, 2)
+
+		RegisterClientTransport("custom", func(options *ClientTransportOptions) (ClientTransport, error) {
+			created <- options
+			return newPollingClientTransport(options)
+		})
+		defer func() {
+			clientTransportsMu.Lock()
+			defer clientTransportsMu.Unlock()
+			delete(clientTransports, "custom")
+		}()
+		websocketFactory, ok := getClientTransport("websocket")
+		require.True(t, ok)
+		RegisterClientTransport("websocket", func(options *ClientTransportOptions) (ClientTransport, error) {
+			created <- options
+			return websocketFactory(options)
+		})
+		defer RegisterClientTransport("websocket", websocketFactory)
+
+		io := newTestServer(nil, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		upgradeDone := func(transportName string) {
+			defer tw.Done()
+			assert.Equal(t, "websocket", transportName)
+		}
+		socket := testDial(t, s.URL, nil, &ClientConfig{Transports: []string{"custom", "websocket"}, UpgradeDone: upgradeDone}, nil)
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+
+		options := <-created
+		require.Empty(t, options.SID, "the first transport should be created for the handshake")
+		require.Equal(t, ProtocolVersion, options.ProtocolVersion)
+		options = <-created
+		require.Equal(t, socket.ID(), options.SID, "the second transport should be created for the upgrade")
+	})
+
+	t.Run("`Stats` should track the transport statistics", func(t *testing.T) {
+		var (
+			tw           = NewTestWaiter(2)
+			serverSocket = make(chan ServerSocket, 1)
+		)
+		onSocket := func(socket ServerSocket) *Callbacks {
+			serverSocket <- socket
+			return &Callbacks{
+				OnPacket: func(packets ...*parser.Packet) {
+					for _, packet := range packets {
+						if packet.Type == parser.PacketTypeMessage {
+							tw.Done()
+						}
+					}
+				},
+			}
+		}
+		io := newTestServer(onSocket, &ServerConfig{PingInterval: time.Second}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		upgraded := NewTestWaiter(1)
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports:  []string{"polling", "websocket"},
+			UpgradeDone: func(transportName string) { upgraded.Done() },
+		}, nil)
+		upgraded.WaitTimeout(t, DefaultTestWaitTimeout)
+
+		socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("hello")))
+		socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, true, []byte{0x1, 0x2}))
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+
+		stats := socket.Stats()
+		require.Equal(t, "websocket", stats.TransportName)
+		require.Equal(t, 1, stats.Upgrades)
+		require.GreaterOrEqual(t, stats.PacketsSent, uint64(2))
+		require.GreaterOrEqual(t, stats.BytesSent, uint64(len("4hello")+2))
+		require.Greater(t, stats.Age, time.Duration(0))
+
+		// Wait for two pings, so that the client can measure the round-trip time.
+		time.Sleep(2500 * time.Millisecond)
+
+		stats = socket.Stats()
+		require.Greater(t, stats.RTT, time.Duration(0))
+
+		stats = (<-serverSocket).Stats()
+		require.Equal(t, "websocket", stats.TransportName)
+		require.Equal(t, 1, stats.Upgrades)
+		require.GreaterOrEqual(t, stats.PacketsReceived, uint64(3)) // 2 messages and a pong
+		require.GreaterOrEqual(t, stats.BytesReceived, uint64(len("4hello")+2))
+		require.Greater(t, stats.PacketsSent, uint64(0))
+		require.Greater(t, stats.RTT, time.Duration(0))
+	})
+
+	t.Run("`Stats` should not count the packets dropped by the fault injection", func(t *testing.T) {
+		io := newTestServer(nil, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports: []string{"polling"},
+			FaultInjection: &FaultInjectionConfig{
+				Schedule: func(transportName string, n int, packet *parser.Packet) Fault {
+					if n == 1 {
+						return FaultDrop
+					}
+					return FaultDuplicate
+				},
+			},
+		}, nil)
+
+		socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("dropped")))
+		stats := socket.Stats()
+		require.Equal(t, uint64(0), stats.PacketsSent)
+		require.Equal(t, uint64(0), stats.BytesSent)
+
+		socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("duplicated")))
+		stats = socket.Stats()
+		require.Equal(t, uint64(2), stats.PacketsSent)
+		require.Equal(t, uint64(2*len("4duplicated")), stats.BytesSent)
+	})
+
+	t.Run("`Dial` should return the server error if the handshake is rejected", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			AuthenticatorWithError: func(w http.ResponseWriter, r *http.Request) error {
+				return &ServerError{Code: 4001, Message: "Banned", Context: "spam"}
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		for _, transports := range [][]string{{"polling"}, {"websocket"}} {
+			_, err = Dial(s.URL, nil, &ClientConfig{Transports: transports})
+			var se *ServerError
+			require.ErrorAs(t, err, &se, "transports: %v", transports)
+			require.Equal(t, 4001, se.Code)
+			require.Equal(t, "Banned", se.Message)
+			require.Equal(t, "spam", se.Context)
+			require.Equal(t, http.StatusForbidden, se.StatusCode)
+		}
+	})
+
+	t.Run("`Dial` should return the status code set on the server error", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			AuthenticatorWithError: func(w http.ResponseWriter, r *http.Request) error {
+				return &ServerError{Code: 4002, Message: "Try again later", StatusCode: http.StatusServiceUnavailable}
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		for _, transports := range [][]string{{"polling"}, {"websocket"}} {
+			_, err = Dial(s.URL, nil, &ClientConfig{Transports: transports})
+			var se *ServerError
+			require.ErrorAs(t, err, &se, "transports: %v", transports)
+			require.Equal(t, 4002, se.Code)
+			require.Equal(t, http.StatusServiceUnavailable, se.StatusCode)
+		}
+	})
+
+	t.Run("`Dial` should return `ErrorForbidden` if the authenticator returns an error", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			AuthenticatorWithError: func(w http.ResponseWriter, r *http.Request) error {
+				return errors.New("not a server error")
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		_, err = Dial(s.URL, nil, &ClientConfig{Transports: []string{"polling"}})
+		var se *ServerError
+		require.ErrorAs(t, err, &se)
+		expected, _ := GetServerError(ErrorForbidden)
+		require.Equal(t, expected.Code, se.Code)
+		require.Equal(t, expected.Message, se.Message)
+		require.Equal(t, http.StatusForbidden, se.StatusCode)
+	})
+
+	t.Run("should send the cookies set by the server if `CookieJar` is set", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+
+		io := newTestServer(nil, &ServerConfig{Cookie: &CookieConfig{}}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			mu            sync.Mutex
+			websocketSIDs []string
+		)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("transport") == "websocket" {
+				cookie, err := r.Cookie("io")
+				if err == nil {
+					mu.Lock()
+					websocketSIDs = append(websocketSIDs, cookie.Value)
+					mu.Unlock()
+				}
+			}
+			io.ServeHTTP(w, r)
+		}))
+
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports: []string{"polling", "websocket"},
+			UpgradeDone: func(transportName string) {
+				tw.Done()
+			},
+			CookieJar: jar,
+		}, nil)
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+
+		u, err := url.Parse(s.URL)
+		require.NoError(t, err)
+		cookies := jar.Cookies(u)
+		require.Equal(t, 1, len(cookies))
+		require.Equal(t, "io", cookies[0].Name)
+		require.Equal(t, socket.ID(), cookies[0].Value)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, []string{socket.ID()}, websocketSIDs)
+	})
+
 	t.Run("should merge packets", func(t *testing.T) {
 		tw := NewTestWaiter(2)
 
@@ -401,4 +736,588 @@ func TestClient(t *testing.T) {
 
 		tw.WaitTimeout(t, DefaultTestWaitTimeout)
 	})
+
+	t.Run("`DialContext` should return when the context is done", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-block:
+			case <-r.Context().Done():
+			}
+		}))
+		defer s.Close()
+
+		for _, transports := range [][]string{{"polling"}, {"websocket"}} {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			_, err := DialContext(ctx, s.URL, nil, &ClientConfig{Transports: transports})
+			cancel()
+			require.ErrorIs(t, err, context.DeadlineExceeded, "transports: %v", transports)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := DialContext(ctx, s.URL, nil, nil)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("should not close the connection when the context of `DialContext` is done after the connection", func(t *testing.T) {
+		for _, transports := range [][]string{{"polling"}, {"websocket"}} {
+			tw := NewTestWaiter(1)
+			io := newTestServer(func(socket ServerSocket) *Callbacks {
+				return &Callbacks{
+					OnPacket: func(packets ...*parser.Packet) {
+						for _, packet := range packets {
+							if packet.Type == parser.PacketTypeMessage {
+								tw.Done()
+							}
+						}
+					},
+				}
+			}, nil, nil)
+			err := io.Run()
+			require.NoError(t, err)
+			s := httptest.NewServer(io)
+
+			var done atomic.Bool
+			ctx, cancel := context.WithCancel(context.Background())
+			socket, err := DialContext(ctx, s.URL, &Callbacks{
+				OnClose: func(reason Reason, err error) {
+					if !done.Load() {
+						t.Errorf("unexpected close: %s %v", reason, err)
+					}
+				},
+			}, &ClientConfig{Transports: transports})
+			require.NoError(t, err)
+			cancel()
+
+			time.Sleep(50 * time.Millisecond)
+			socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("hello")))
+			tw.WaitTimeout(t, DefaultTestWaitTimeout)
+
+			done.Store(true)
+			io.Close()
+			s.Close()
+		}
+	})
+
+	t.Run("should connect to a Unix domain socket", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "eio")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		socketPath := filepath.Join(dir, "eio.sock")
+
+		for _, transports := range [][]string{{"polling"}, {"websocket"}} {
+			tw := NewTestWaiter(1)
+			io := newTestServer(func(socket ServerSocket) *Callbacks {
+				return &Callbacks{
+					OnPacket: func(packets ...*parser.Packet) {
+						for _, packet := range packets {
+							if packet.Type == parser.PacketTypeMessage {
+								defer tw.Done()
+								assert.Equal(t, "hello", string(packet.Data))
+							}
+						}
+					},
+				}
+			}, nil, nil)
+			err = io.Run()
+			require.NoError(t, err)
+
+			ln, err := net.Listen("unix", socketPath)
+			require.NoError(t, err)
+			mux := http.NewServeMux()
+			mux.Handle("/engine.io/", io)
+			go http.Serve(ln, mux)
+
+			socket := testDial(t, "unix://"+socketPath+":/engine.io/", nil, &ClientConfig{Transports: transports}, nil)
+			require.Equal(t, transports[0], socket.TransportName())
+			socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("hello")))
+
+			tw.WaitTimeout(t, DefaultTestWaitTimeout)
+			socket.Close()
+			ln.Close()
+		}
+	})
+
+	t.Run("should use `DialContext` and `Proxy`", func(t *testing.T) {
+		io := newTestServer(nil, nil, nil)
+		err := io.Run()
+		require.NoError(t, err)
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		for _, transports := range [][]string{{"polling"}, {"websocket"}} {
+			var dialed, proxied atomic.Int32
+			config := &ClientConfig{
+				Transports: transports,
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					dialed.Add(1)
+					return new(net.Dialer).DialContext(ctx, network, addr)
+				},
+				Proxy: func(r *http.Request) (*url.URL, error) {
+					proxied.Add(1)
+					return nil, nil
+				},
+			}
+			socket := testDial(t, s.URL, nil, config, nil)
+			require.Equal(t, transports[0], socket.TransportName())
+			socket.Close()
+
+			assert.NotZero(t, dialed.Load(), "transports: %v", transports)
+			assert.NotZero(t, proxied.Load(), "transports: %v", transports)
+		}
+	})
+
+	t.Run("should use `DialContext` for the webtransport transport", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		tlsConfig := newTestWebTransportServer(t, conn, func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnPacket: func(packets ...*parser.Packet) {
+					for _, packet := range packets {
+						if packet.Type == parser.PacketTypeMessage {
+							defer tw.Done()
+							assert.Equal(t, "hello", string(packet.Data))
+						}
+					}
+				},
+			}
+		})
+
+		var dialed atomic.Int32
+		socket := testDial(t, "http://"+conn.LocalAddr().String()+"/engine.io/", nil, &ClientConfig{
+			Transports: []string{"webtransport"},
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialed.Add(1)
+				assert.Equal(t, "udp", network)
+				return new(net.Dialer).DialContext(ctx, network, addr)
+			},
+			WebTransportDialer: &webtransport.Dialer{TLSClientConfig: tlsConfig},
+		}, nil)
+		require.Equal(t, "webtransport", socket.TransportName())
+		socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("hello")))
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+		socket.Close()
+		assert.Equal(t, int32(1), dialed.Load())
+	})
+
+	t.Run("should connect to a Unix domain socket with the webtransport transport", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+		socketPath := filepath.Join(t.TempDir(), "eio.sock")
+		conn, err := net.ListenPacket("unixgram", socketPath)
+		require.NoError(t, err)
+		tlsConfig := newTestWebTransportServer(t, conn, func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnPacket: func(packets ...*parser.Packet) {
+					for _, packet := range packets {
+						if packet.Type == parser.PacketTypeMessage {
+							defer tw.Done()
+							assert.Equal(t, "hello", string(packet.Data))
+						}
+					}
+				},
+			}
+		})
+
+		socket := testDial(t, "unix://"+socketPath+":/engine.io/", nil, &ClientConfig{
+			Transports:         []string{"webtransport"},
+			WebTransportDialer: &webtransport.Dialer{TLSClientConfig: tlsConfig},
+		}, nil)
+		require.Equal(t, "webtransport", socket.TransportName())
+		socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("hello")))
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+		socket.Close()
+	})
+
+	t.Run("webtransport transport should fail if a proxy is to be used", func(t *testing.T) {
+		_, err := Dial("https://localhost:4433", nil, &ClientConfig{
+			Transports: []string{"webtransport"},
+			Proxy:      http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy:8080"}),
+		})
+		require.ErrorContains(t, err, "cannot be used through a proxy")
+	})
+
+	t.Run("`Dial` should return an error if `DialContext` is set along with `WebTransportDialer.DialAddr`", func(t *testing.T) {
+		_, err := Dial("https://localhost:4433", nil, &ClientConfig{
+			DialContext: new(net.Dialer).DialContext,
+			WebTransportDialer: &webtransport.Dialer{
+				DialAddr: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+					return nil, errors.New("unreachable")
+				},
+			},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("`Dial` should return an error if `DialContext` is set and `HTTPTransport` is not a *http.Transport", func(t *testing.T) {
+		_, err := Dial("http://localhost", nil, &ClientConfig{
+			HTTPTransport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				return nil, errors.New("unreachable")
+			}),
+			DialContext: new(net.Dialer).DialContext,
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("should parse unix URLs", func(t *testing.T) {
+		u, socketPath, err := parseURL("unix:///var/run/app.sock:/socket.io/?a=b")
+		require.NoError(t, err)
+		assert.Equal(t, "/var/run/app.sock", socketPath)
+		assert.Equal(t, "http://localhost/socket.io/?a=b", u.String())
+
+		u, socketPath, err = parseURL("unix:///var/run/app.sock")
+		require.NoError(t, err)
+		assert.Equal(t, "/var/run/app.sock", socketPath)
+		assert.Equal(t, "/", u.Path)
+
+		u, socketPath, err = parseURL("unix:///var/run/app%3A1.sock:/socket.io/")
+		require.NoError(t, err)
+		assert.Equal(t, "/var/run/app:1.sock", socketPath)
+		assert.Equal(t, "/socket.io/", u.Path)
+
+		_, _, err = parseURL("unix://host/var/run/app.sock")
+		require.Error(t, err)
+	})
+
+	t.Run("should use `Path` and `Query`", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+
+		io := newTestServer(nil, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			mu       sync.Mutex
+			requests int
+		)
+		mux := http.NewServeMux()
+		mux.Handle("/custom/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "bar", r.URL.Query().Get("foo"))
+			assert.Equal(t, "1", r.URL.Query().Get("a"))
+			mu.Lock()
+			requests++
+			mu.Unlock()
+			io.ServeHTTP(w, r)
+		}))
+		s := httptest.NewServer(mux)
+		defer s.Close()
+
+		socket := testDial(t, s.URL+"/other/?a=1", nil, &ClientConfig{
+			Transports: []string{"polling", "websocket"},
+			Path:       "/custom",
+			Query:      url.Values{"foo": {"bar"}},
+			UpgradeDone: func(transportName string) {
+				tw.Done()
+			},
+		}, nil)
+		defer socket.Close()
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Greater(t, requests, 1)
+	})
+
+	t.Run("should call `RequestHeaderFunc` and `QueryFunc` before every request", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+
+		io := newTestServer(nil, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			mu     sync.Mutex
+			tokens = make(map[string]bool)
+		)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get("token")
+			assert.Equal(t, "Bearer "+token, r.Header.Get("Authorization"))
+			mu.Lock()
+			tokens[token] = true
+			mu.Unlock()
+			io.ServeHTTP(w, r)
+		}))
+		defer s.Close()
+
+		var headerCalls, queryCalls atomic.Int32
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports: []string{"polling", "websocket"},
+			RequestHeaderFunc: func() (http.Header, error) {
+				n := headerCalls.Add(1)
+				return http.Header{"Authorization": {fmt.Sprintf("Bearer %d", n)}}, nil
+			},
+			QueryFunc: func() (url.Values, error) {
+				n := queryCalls.Add(1)
+				return url.Values{"token": {fmt.Sprint(n)}}, nil
+			},
+			UpgradeDone: func(transportName string) {
+				tw.Done()
+			},
+		}, nil)
+		defer socket.Close()
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+
+		mu.Lock()
+		defer mu.Unlock()
+		// At least the handshake and the upgrade request.
+		require.GreaterOrEqual(t, len(tokens), 2)
+		require.True(t, tokens["1"])
+	})
+
+	t.Run("`Dial` should return the error of `RequestHeaderFunc`", func(t *testing.T) {
+		io := newTestServer(nil, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		tokenErr := errors.New("token refresh failed")
+		_, err = Dial(s.URL, nil, &ClientConfig{
+			Transports: []string{"polling"},
+			RequestHeaderFunc: func() (http.Header, error) {
+				return nil, tokenErr
+			},
+		})
+		require.ErrorIs(t, err, tokenErr)
+	})
+
+	t.Run("should fall back to the other transports if `TryAllTransports` is set", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{Transports: []string{"polling"}}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		_, err = Dial(s.URL, nil, &ClientConfig{Transports: []string{"websocket"}})
+		require.Error(t, err)
+
+		var (
+			mu     sync.Mutex
+			failed []string
+		)
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports:       []string{"websocket"},
+			TryAllTransports: true,
+			TransportFailed: func(transportName string, err error) {
+				assert.Error(t, err)
+				mu.Lock()
+				failed = append(failed, transportName)
+				mu.Unlock()
+			},
+		}, nil)
+		defer socket.Close()
+		require.Equal(t, "polling", socket.TransportName())
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, []string{"websocket"}, failed)
+	})
+
+	t.Run("should append the fallback transports", func(t *testing.T) {
+		assert.Equal(t, []string{"websocket", "polling"}, withFallbackTransports([]string{"websocket"}))
+		assert.Equal(t, []string{"webtransport", "websocket", "polling"}, withFallbackTransports([]string{"webtransport"}))
+		assert.Equal(t, []string{"polling", "websocket"}, withFallbackTransports([]string{"polling", "websocket"}))
+		assert.Equal(t, []string{"memory"}, withFallbackTransports([]string{"memory"}))
+	})
+
+	t.Run("should close the transport if a packet exceeds `MaxBufferSize` (polling)", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("123456789")))
+			return nil
+		}, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		testDial(t, s.URL, &Callbacks{
+			OnPacket: func(packets ...*parser.Packet) {
+				for _, packet := range packets {
+					assert.NotEqual(t, parser.PacketTypeMessage, packet.Type)
+				}
+			},
+			OnClose: func(reason Reason, err error) {
+				defer tw.Done()
+				assert.Equal(t, ReasonTransportError, reason)
+				assert.ErrorIs(t, err, parser.ErrPacketTooLarge)
+			},
+		}, &ClientConfig{
+			Transports:    []string{"polling"},
+			MaxBufferSize: 5,
+		}, nil)
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("should close the transport if a payload exceeds `MaxBufferSize` (polling)", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			// Each packet is under the limit, but the payload is not.
+			socket.Send(
+				mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("123456")),
+				mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("123456")),
+				mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("123456")),
+			)
+			return nil
+		}, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		// The packets are passed to OnPacket as they are decoded.
+		// Only the first packet fits into the limit.
+		var messages atomic.Int32
+		testDial(t, s.URL, &Callbacks{
+			OnPacket: func(packets ...*parser.Packet) {
+				for _, packet := range packets {
+					if packet.Type == parser.PacketTypeMessage {
+						messages.Add(1)
+					}
+				}
+			},
+			OnClose: func(reason Reason, err error) {
+				defer tw.Done()
+				assert.Equal(t, ReasonTransportError, reason)
+				assert.ErrorIs(t, err, parser.ErrPayloadTooLarge)
+				assert.LessOrEqual(t, messages.Load(), int32(1))
+			},
+		}, &ClientConfig{
+			Transports:    []string{"polling"},
+			MaxBufferSize: 10,
+		}, nil)
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("should send and receive with the memory transport", func(t *testing.T) {
+		tw := NewTestWaiter(4)
+		textPacket := mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("testing123"))
+		binaryPacket := mustCreatePacket(t, parser.PacketTypeMessage, true, []byte{0x0, 0x1, 0x2, 0x3})
+
+		check := func(packets ...*parser.Packet) {
+			for _, packet := range packets {
+				if packet.Type != parser.PacketTypeMessage {
+					continue
+				}
+				defer tw.Done()
+				if packet.IsBinary {
+					assert.Equal(t, binaryPacket.Data, packet.Data)
+				} else {
+					assert.Equal(t, textPacket.Data, packet.Data)
+				}
+			}
+		}
+
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			assert.Equal(t, "memory", socket.TransportName())
+			go socket.Send(textPacket, binaryPacket)
+			return &Callbacks{OnPacket: check}
+		}, &ServerConfig{Transports: []string{"polling", "websocket", "memory"}}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		memory.Register("eio-client-test", io)
+		defer memory.Unregister("eio-client-test")
+
+		socket := testDial(t, "memory://eio-client-test", &Callbacks{OnPacket: check}, nil, nil)
+		require.Equal(t, "memory", socket.TransportName())
+		socket.Send(textPacket, binaryPacket)
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("`Dial` should return the server error if the handshake is rejected with the memory transport", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			Transports: []string{"memory"},
+			Authenticator: func(w http.ResponseWriter, r *http.Request) (ok bool) {
+				return false
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		memory.Register("eio-client-test-rejected", io)
+		defer memory.Unregister("eio-client-test-rejected")
+
+		_, err = Dial("memory://eio-client-test-rejected", nil, nil)
+		var se *ServerError
+		require.ErrorAs(t, err, &se)
+		require.Equal(t, serverErrors[ErrorForbidden].Code, se.Code)
+		require.Equal(t, http.StatusForbidden, se.StatusCode)
+
+		_, err = Dial("memory://not-registered", nil, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("the memory transport should not be accepted by default", func(t *testing.T) {
+		io := newTestServer(nil, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		memory.Register("eio-client-test-default", io)
+		defer memory.Unregister("eio-client-test-default")
+
+		_, err = Dial("memory://eio-client-test-default", nil, nil)
+		var se *ServerError
+		require.ErrorAs(t, err, &se)
+		expected, _ := GetServerError(ErrorUnknownTransport)
+		require.Equal(t, expected.Code, se.Code)
+	})
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// Serve an Engine.IO server over WebTransport on conn.
+// The returned TLS configuration trusts the certificate of the server.
+func newTestWebTransportServer(t *testing.T, conn net.PacketConn, onSocket NewSocketCallback) *tls.Config {
+	// Borrow the certificate of httptest.
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	wts := &webtransport.Server{
+		H3: http3.Server{
+			TLSConfig: &tls.Config{Certificates: ts.TLS.Certificates},
+		},
+	}
+	io := newTestServer(onSocket, &ServerConfig{
+		Transports:         []string{"webtransport"},
+		WebTransportServer: wts,
+	}, nil)
+	err := io.Run()
+	require.NoError(t, err)
+	wts.H3.Handler = io
+
+	go wts.Serve(conn)
+	t.Cleanup(func() {
+		wts.Close()
+		conn.Close()
+	})
+	return &tls.Config{RootCAs: roots, ServerName: "example.com"}
 }
@@ -0,0 +1,90 @@
+package eio
+
+import (
+	"compress/flate"
+
+	"nhooyr.io/websocket"
+)
+
+const (
+	defaultPerMessageDeflateThreshold = 1024
+	defaultHTTPCompressionThreshold   = 1024
+)
+
+// Configuration of the permessage-deflate extension of the websocket transport.
+//
+// Packets are compressed unless their SkipCompression field is set or they are smaller than Threshold.
+type PerMessageDeflateConfig struct {
+	// Messages smaller than this (in bytes) are not compressed.
+	//
+	// Default: 1024
+	Threshold int
+
+	// If this is set, each message is compressed with a fresh compression context.
+	// This uses less memory but compresses less efficiently.
+	//
+	// Default: false
+	NoContextTakeover bool
+}
+
+func (c *PerMessageDeflateConfig) mode() websocket.CompressionMode {
+	if c.NoContextTakeover {
+		return websocket.CompressionNoContextTakeover
+	}
+	return websocket.CompressionContextTakeover
+}
+
+func (c *PerMessageDeflateConfig) threshold() int {
+	if c.Threshold <= 0 {
+		return defaultPerMessageDeflateThreshold
+	}
+	return c.Threshold
+}
+
+func (c *PerMessageDeflateConfig) acceptOptions(options *websocket.AcceptOptions) *websocket.AcceptOptions {
+	var o websocket.AcceptOptions
+	if options != nil {
+		o = *options
+	}
+	o.CompressionMode = c.mode()
+	o.CompressionThreshold = c.threshold()
+	return &o
+}
+
+func (c *PerMessageDeflateConfig) dialOptions(options *websocket.DialOptions) *websocket.DialOptions {
+	var o websocket.DialOptions
+	if options != nil {
+		o = *options
+	}
+	o.CompressionMode = c.mode()
+	o.CompressionThreshold = c.threshold()
+	return &o
+}
+
+// Configuration of the gzip/deflate compression of the polling responses.
+//
+// A response is compressed only if at least one of its packets doesn't have the SkipCompression field set.
+type HTTPCompressionConfig struct {
+	// Responses smaller than this (in bytes) are not compressed.
+	//
+	// Default: 1024
+	Threshold int
+
+	// Compression level (see: compress/flate).
+	// If this is 0, flate.DefaultCompression is used.
+	Level int
+}
+
+func (c *HTTPCompressionConfig) threshold() int {
+	if c.Threshold <= 0 {
+		return defaultHTTPCompressionThreshold
+	}
+	return c.Threshold
+}
+
+func (c *HTTPCompressionConfig) level() int {
+	if c.Level == 0 {
+		return flate.DefaultCompression
+	}
+	return c.Level
+}
@@ -9,8 +9,14 @@ import (
 const (
 	ProtocolVersion = parser.ProtocolVersion
 
+	// Engine.IO protocol v3. This is used by the Socket.IO v2 clients. See ServerConfig.AllowEIO3.
+	ProtocolVersion3 = parser.ProtocolVersion3
+
 	defaultMaxBufferSize  int64 = 1e6 // 100 MB
 	defaultPingTimeout          = time.Second * 20
 	defaultPingInterval         = time.Second * 25
 	defaultUpgradeTimeout       = time.Second * 10
+	defaultRetryAfter           = time.Second * 5
+
+	defaultFaultStallDuration = time.Second
 )
@@ -0,0 +1,69 @@
+package eio
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	defaultCookieName = "io"
+	defaultCookiePath = "/"
+)
+
+// Configuration of the cookie that is set on handshake. The value of the cookie is the session ID.
+//
+// This is useful for sticky sessions: a load balancer can route the requests
+// of a session to the same server by looking at this cookie.
+type CookieConfig struct {
+	// Name of the cookie.
+	//
+	// Default: "io"
+	Name string
+
+	// Path of the cookie.
+	//
+	// Default: "/"
+	Path string
+
+	// Don't set the HttpOnly attribute. By default, the attribute is set,
+	// so that the session ID can't be read by the scripts on the page.
+	//
+	// This is the equivalent of `cookie: { httpOnly: false }` in original Engine.IO.
+	DisableHttpOnly bool
+
+	// SameSite attribute of the cookie.
+	//
+	// Default: http.SameSiteLaxMode
+	SameSite http.SameSite
+
+	// Whether the Secure attribute is set.
+	Secure bool
+
+	// Lifetime of the cookie. If this is 0, a session cookie (without Max-Age) is set.
+	MaxAge time.Duration
+}
+
+func (c *CookieConfig) cookie(sid string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    sid,
+		Path:     c.Path,
+		HttpOnly: !c.DisableHttpOnly,
+		SameSite: c.SameSite,
+		Secure:   c.Secure,
+	}
+
+	if cookie.Name == "" {
+		cookie.Name = defaultCookieName
+	}
+	if cookie.Path == "" {
+		cookie.Path = defaultCookiePath
+	}
+	if cookie.SameSite == 0 {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	if c.MaxAge > 0 {
+		cookie.MaxAge = int(c.MaxAge / time.Second)
+	}
+	return cookie
+}
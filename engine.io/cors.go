@@ -0,0 +1,180 @@
+package eio
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+type (
+	// Return true if the origin is allowed to access the server.
+	CORSAllowOriginFunc func(origin string, r *http.Request) (ok bool)
+
+	CORSConfig struct {
+		// List of origins that are allowed to access the server (e.g. "https://example.com").
+		// Use "*" to allow any origin.
+		//
+		// This is ignored if AllowOriginFunc is set.
+		AllowedOrigins []string
+
+		// A custom function to validate the origin.
+		// If this is set, AllowedOrigins is ignored.
+		AllowOriginFunc CORSAllowOriginFunc
+
+		// Whether to set the Access-Control-Allow-Credentials header.
+		//
+		// If this is set, the origin of the request is reflected
+		// instead of "*" in the Access-Control-Allow-Origin header.
+		AllowCredentials bool
+
+		// Headers that the client is allowed to use with the preflight (OPTIONS) requests.
+		// If this is empty, the headers found in Access-Control-Request-Headers are reflected.
+		AllowedHeaders []string
+
+		// How long the results of a preflight request can be cached.
+		// If this is 0, Access-Control-Max-Age header is not set.
+		MaxAge time.Duration
+	}
+)
+
+type cors struct {
+	allowedOrigins  []string
+	allowAnyOrigin  bool
+	allowOriginFunc CORSAllowOriginFunc
+
+	allowCredentials bool
+	allowedHeaders   string
+	maxAge           string
+}
+
+func newCORS(config *CORSConfig) *cors {
+	c := &cors{
+		allowOriginFunc:  config.AllowOriginFunc,
+		allowCredentials: config.AllowCredentials,
+		allowedHeaders:   strings.Join(config.AllowedHeaders, ", "),
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			c.allowAnyOrigin = true
+			continue
+		}
+		c.allowedOrigins = append(c.allowedOrigins, strings.ToLower(strings.TrimSuffix(origin, "/")))
+	}
+
+	if config.MaxAge > 0 {
+		c.maxAge = strconv.FormatInt(int64(config.MaxAge/time.Second), 10)
+	}
+	return c
+}
+
+func (c *cors) isOriginAllowed(origin string, r *http.Request) bool {
+	if c.allowOriginFunc != nil {
+		return c.allowOriginFunc(origin, r)
+	}
+	if c.allowAnyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, o := range c.allowedOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// Set the CORS headers. If this is a preflight request, reply to it.
+//
+// Return value of handled is true if the request is completely handled and nothing else should be written.
+func (c *cors) handle(w http.ResponseWriter, r *http.Request) (handled bool) {
+	var (
+		wh          = w.Header()
+		origin      = r.Header.Get("Origin")
+		isPreflight = r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+	)
+
+	wh.Add("Vary", "Origin")
+	if origin == "" {
+		return false
+	}
+
+	if !c.isOriginAllowed(origin, r) {
+		if isPreflight {
+			writeServerError(w, ErrorForbidden)
+			return true
+		}
+		return false
+	}
+
+	if c.allowAnyOrigin && !c.allowCredentials && c.allowOriginFunc == nil {
+		wh.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		wh.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.allowCredentials {
+		wh.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !isPreflight {
+		return false
+	}
+
+	wh.Add("Vary", "Access-Control-Request-Method")
+	wh.Add("Vary", "Access-Control-Request-Headers")
+	wh.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+
+	if c.allowedHeaders != "" {
+		wh.Set("Access-Control-Allow-Headers", c.allowedHeaders)
+	} else if requestHeaders := r.Header.Get("Access-Control-Request-Headers"); requestHeaders != "" {
+		wh.Set("Access-Control-Allow-Headers", requestHeaders)
+	}
+
+	if c.maxAge != "" {
+		wh.Set("Access-Control-Max-Age", c.maxAge)
+	}
+
+	wh.Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// Apply the origin policy to the WebSocket accept options.
+//
+// The websocket package matches the host of the origin against OriginPatterns.
+// If a custom function or a wildcard is used, the origin is checked by us (see: Server.ServeHTTP),
+// so the websocket package's own check is disabled.
+func (c *cors) webSocketAcceptOptions(options *websocket.AcceptOptions) *websocket.AcceptOptions {
+	var o websocket.AcceptOptions
+	if options != nil {
+		o = *options
+	}
+
+	if c.allowOriginFunc != nil || c.allowAnyOrigin {
+		o.InsecureSkipVerify = true
+		return &o
+	}
+
+	patterns := make([]string, 0, len(o.OriginPatterns)+len(c.allowedOrigins))
+	patterns = append(patterns, o.OriginPatterns...)
+	for _, origin := range c.allowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			// Probably a host without scheme.
+			patterns = append(patterns, origin)
+			continue
+		}
+		patterns = append(patterns, u.Host)
+	}
+	o.OriginPatterns = patterns
+	return &o
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
@@ -0,0 +1,250 @@
+package eio
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+	"nhooyr.io/websocket"
+)
+
+// URL scheme for connecting to a server listening on a Unix domain socket.
+//
+// The URL consists of the path of the socket and the HTTP path, separated by the first colon.
+// For example: unix:///var/run/app.sock:/socket.io/
+// A colon in the path of the socket must be percent-encoded as %3A.
+const unixScheme = "unix"
+
+// The network configuration of the client transports.
+type clientDialer struct {
+	dialContext ClientDialContextFunc
+	proxy       ClientProxyFunc
+
+	// Path of the Unix domain socket. Empty if the URL is not a unix URL.
+	socketPath string
+}
+
+func newClientDialer(config *ClientConfig, socketPath string) *clientDialer {
+	d := &clientDialer{
+		dialContext: config.DialContext,
+		proxy:       config.Proxy,
+		socketPath:  socketPath,
+	}
+	if socketPath != "" {
+		dialContext := d.dialContext
+		if dialContext == nil {
+			dialContext = dialUnix
+		}
+		d.dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// The webtransport transport dials "udp".
+			if network == "udp" {
+				return dialContext(ctx, "unixgram", socketPath)
+			}
+			return dialContext(ctx, "unix", socketPath)
+		}
+		// Never use a proxy for a Unix domain socket.
+		d.proxy = func(r *http.Request) (*url.URL, error) { return nil, nil }
+	}
+	return d
+}
+
+// Whether the default network configuration is changed.
+func (d *clientDialer) isCustom() bool {
+	return d.dialContext != nil || d.proxy != nil
+}
+
+// Return a copy of t with the dialer and the proxy set.
+// If t is nil, http.DefaultTransport is used.
+func (d *clientDialer) httpTransport(t http.RoundTripper) (http.RoundTripper, error) {
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	ht, ok := t.(*http.Transport)
+	if !ok {
+		if d.isCustom() {
+			return nil, fmt.Errorf("eio: DialContext, Proxy and unix URLs can only be used with an *http.Transport")
+		}
+		return t, nil
+	}
+	// Clone the transport, so that we don't change the default timeouts later on. See: polling/client.go
+	// If we're unable to clone the transport, leave it as it is.
+	ht = ht.Clone()
+	if d.dialContext != nil {
+		ht.DialContext = d.dialContext
+	}
+	if d.proxy != nil {
+		ht.Proxy = d.proxy
+	}
+	return ht, nil
+}
+
+// Return a copy of the options with an HTTP client that uses the dialer and the proxy.
+func (d *clientDialer) wsDialOptions(options *websocket.DialOptions) (*websocket.DialOptions, error) {
+	if !d.isCustom() {
+		return options, nil
+	}
+	o := *options
+	var c http.Client
+	if o.HTTPClient != nil {
+		c = *o.HTTPClient
+	}
+	t, err := d.httpTransport(c.Transport)
+	if err != nil {
+		return nil, err
+	}
+	c.Transport = t
+	o.HTTPClient = &c
+	return &o, nil
+}
+
+// Return a webtransport dialer that dials the QUIC connection with the dialer.
+// If the default dialer is used, wd is returned as it is.
+func (d *clientDialer) webTransportDialer(wd *webtransport.Dialer) (*webtransport.Dialer, error) {
+	if d.dialContext == nil {
+		return wd, nil
+	}
+	if wd.DialAddr != nil {
+		return nil, fmt.Errorf("eio: DialContext and unix URLs cannot be used with WebTransportDialer.DialAddr")
+	}
+	// A webtransport.Dialer must not be copied, create a new one with the same configuration.
+	return &webtransport.Dialer{
+		TLSClientConfig:         wd.TLSClientConfig,
+		QUICConfig:              wd.QUICConfig,
+		StreamReorderingTimeout: wd.StreamReorderingTimeout,
+		DialAddr:                d.dialQUIC,
+	}, nil
+}
+
+// Dial a QUIC connection over the datagram connection returned by the dialer.
+func (d *clientDialer) dialQUIC(ctx context.Context, addr string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlyConnection, error) {
+	conn, err := d.dialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tr := &quic.Transport{Conn: &datagramConn{Conn: conn}}
+	qconn, err := tr.DialEarly(ctx, conn.RemoteAddr(), tlsConf, quicConf)
+	if err != nil {
+		tr.Close()
+		conn.Close()
+		return nil, err
+	}
+	// The transport doesn't close a connection it didn't create.
+	context.AfterFunc(qconn.Context(), func() {
+		tr.Close()
+		conn.Close()
+	})
+	return qconn, nil
+}
+
+// Return an error if the proxy is to be used for u.
+// The webtransport transport runs over QUIC, and cannot be tunneled through an HTTP or SOCKS5 proxy.
+func (d *clientDialer) checkNoProxy(u *url.URL) error {
+	if d.proxy == nil {
+		return nil
+	}
+	proxyURL, err := d.proxy(&http.Request{Method: http.MethodConnect, URL: u, Header: make(http.Header)})
+	if err != nil {
+		return err
+	}
+	if proxyURL != nil {
+		return fmt.Errorf("eio: webtransport transport cannot be used through a proxy: %s", proxyURL.Redacted())
+	}
+	return nil
+}
+
+// Adapts a connected datagram connection to net.PacketConn, so that QUIC can run over it.
+type datagramConn struct {
+	net.Conn
+}
+
+func (c *datagramConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	n, err = c.Read(p)
+	return n, c.RemoteAddr(), err
+}
+
+func (c *datagramConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	return c.Write(p)
+}
+
+// The default dialer for unix URLs.
+func dialUnix(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "unixgram" {
+		return new(net.Dialer).DialContext(ctx, network, addr)
+	}
+
+	// A datagram socket must be bound to an address to receive the replies of the server.
+	var b [8]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return nil, err
+	}
+	name := "eio-" + hex.EncodeToString(b[:]) + ".sock"
+	if runtime.GOOS == "linux" {
+		// Use the abstract namespace, so that no file is left behind.
+		dialer := &net.Dialer{LocalAddr: &net.UnixAddr{Name: "@" + name, Net: network}}
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	localPath := filepath.Join(os.TempDir(), name)
+	dialer := &net.Dialer{LocalAddr: &net.UnixAddr{Name: localPath, Net: network}}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		os.Remove(localPath)
+		return nil, err
+	}
+	return &unlinkOnCloseConn{Conn: conn, path: localPath}, nil
+}
+
+// Removes the file of the bound Unix domain socket when it is closed.
+type unlinkOnCloseConn struct {
+	net.Conn
+	path string
+}
+
+func (c *unlinkOnCloseConn) Close() error {
+	err := c.Conn.Close()
+	os.Remove(c.path)
+	return err
+}
+
+// Convert a unix URL into an HTTP URL and the path of the socket.
+func parseUnixURL(u *url.URL) (httpURL *url.URL, socketPath string, err error) {
+	if u.Host != "" {
+		return nil, "", fmt.Errorf("eio: unix URL must have an empty host: %s", u.String())
+	}
+	// Split the escaped path, so that a percent-encoded colon can be used in the path of the socket.
+	socketPath, httpPath, _ := strings.Cut(u.EscapedPath(), ":")
+	socketPath, err = url.PathUnescape(socketPath)
+	if err != nil {
+		return nil, "", err
+	}
+	httpPath, err = url.PathUnescape(httpPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if socketPath == "" {
+		return nil, "", fmt.Errorf("eio: unix URL must contain the path of the socket: %s", u.String())
+	}
+	if httpPath == "" {
+		httpPath = "/"
+	}
+
+	httpURL = &url.URL{
+		Scheme:   "http",
+		Host:     "localhost",
+		Path:     httpPath,
+		RawQuery: u.RawQuery,
+	}
+	return httpURL, socketPath, nil
+}
@@ -18,6 +18,9 @@ import (
 
 const addr = "127.0.0.1:3000"
 
+// Used for the CORS configuration. If this value is empty, CORS will not be enabled.
+var allowOrigin = os.Getenv("ALLOW_ORIGIN")
+
 var (
 	server *http.Server
 
@@ -57,10 +60,24 @@ func logServerError(err error) {
 }
 
 func main() {
-	io := eio.NewServer(onSocket, &eio.ServerConfig{
+	config := &eio.ServerConfig{
 		Authenticator: authenticator,
 		OnError:       logServerError,
-	})
+	}
+
+	if allowOrigin != "" {
+		if !strings.HasPrefix(allowOrigin, "http://") {
+			allowOrigin = "http://" + allowOrigin
+		}
+		fmt.Printf("ALLOW_ORIGIN is set to: %s\n", allowOrigin)
+
+		config.CORS = &eio.CORSConfig{
+			AllowedOrigins:   []string{allowOrigin},
+			AllowCredentials: true,
+		}
+	}
+
+	io := eio.NewServer(onSocket, config)
 
 	err := io.Run()
 	if err != nil {
@@ -70,22 +87,9 @@ func main() {
 	fs := http.FileServer(http.Dir("public"))
 	router := http.NewServeMux()
 
-	if allowOrigin == "" {
-		// Make sure to have a slash at the end of the URL.
-		// Otherwise instead of matching with this handler, requests might match with a file that has an engine.io prefix (such as engine.io.min.js).
-		router.Handle("/engine.io/", io)
-	} else {
-		if !strings.HasPrefix(allowOrigin, "http://") {
-			allowOrigin = "http://" + allowOrigin
-		}
-
-		fmt.Printf("ALLOW_ORIGIN is set to: %s\n", allowOrigin)
-		h := corsMiddleware(io, allowOrigin)
-
-		// Make sure to have a slash at the end of the URL.
-		// Otherwise instead of matching with this handler, requests might match with a file that has an engine.io prefix (such as engine.io.min.js).
-		router.Handle("/engine.io/", h)
-	}
+	// Make sure to have a slash at the end of the URL.
+	// Otherwise instead of matching with this handler, requests might match with a file that has an engine.io prefix (such as engine.io.min.js).
+	router.Handle("/engine.io/", io)
 
 	router.Handle("/", fs)
 
@@ -0,0 +1,251 @@
+package eio
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/tomruk/socket.io-go/engine.io/parser"
+	"github.com/tomruk/socket.io-go/internal/sync"
+)
+
+// A fault to inject into a packet sent by a transport.
+type Fault int
+
+const (
+	// Send the packet as it is.
+	FaultNone Fault = iota
+	// Drop the packet without sending it.
+	FaultDrop
+	// Send the packet twice.
+	FaultDuplicate
+	// Block the Send call for StallDuration, then send the packet.
+	FaultStall
+	// Close the transport (as if the connection is lost) instead of sending the packet.
+	// The packet and the rest of the packets of the Send call are dropped.
+	FaultClose
+)
+
+// Decide the fault to inject into a packet.
+//
+// transportName is the name of the transport, n is the number of the packets sent
+// on the transport so far, including this one (starting from 1).
+type FaultScheduleFunc func(transportName string, n int, packet *parser.Packet) Fault
+
+// Configuration of the fault injection. This is meant to be used for testing the behavior
+// of the clients and the servers under bad network conditions (reconnection, retries, etc.).
+//
+// Faults are injected into the packets that are sent by the transports.
+// Set this on the server to affect the packets sent to the clients,
+// and on the client to affect the packets sent to the server.
+// To wrap a single transport, use WrapServerTransport or WrapClientTransport.
+//
+// Only Schedule is deterministic. The probabilities and the jitter use a random number generator
+// that is shared by all the transports of the server (or the client), and the delays are real sleeps,
+// so the faults that a socket gets depend on the timing of the other sockets.
+type FaultInjectionConfig struct {
+	// Delay to add to every Send call. Send calls block during the delay.
+	Latency time.Duration
+
+	// Random delay to add on top of Latency. The delay is between 0 and Jitter.
+	Jitter time.Duration
+
+	// Probability of dropping a packet. It is between 0 and 1.
+	DropProbability float64
+
+	// Probability of sending a packet twice. It is between 0 and 1.
+	DuplicateProbability float64
+
+	// Probability of stalling the Send call of a packet for StallDuration. It is between 0 and 1.
+	StallProbability float64
+
+	// Probability of closing the transport instead of sending a packet. It is between 0 and 1.
+	CloseProbability float64
+
+	// How long a stalled Send call blocks.
+	//
+	// Default: 1 second
+	StallDuration time.Duration
+
+	// If this is set, it is called for every packet and its result is used instead of the probabilities.
+	// Use this to inject faults deterministically.
+	Schedule FaultScheduleFunc
+
+	// Seed of the random number generator that is used for the probabilities and the jitter.
+	// The same seed produces the same sequence of faults, but only if the packets of all the transports
+	// sharing the generator are sent in the same order. Use Schedule for reproducible faults.
+	Seed int64
+}
+
+type faultInjector struct {
+	latency              time.Duration
+	jitter               time.Duration
+	dropProbability      float64
+	duplicateProbability float64
+	stallProbability     float64
+	closeProbability     float64
+	stallDuration        time.Duration
+	schedule             FaultScheduleFunc
+
+	rand   *rand.Rand
+	randMu sync.Mutex
+}
+
+// If config is nil, nil is returned. A nil *faultInjector doesn't wrap the transports.
+func newFaultInjector(config *FaultInjectionConfig) *faultInjector {
+	if config == nil {
+		return nil
+	}
+	f := &faultInjector{
+		latency:              config.Latency,
+		jitter:               config.Jitter,
+		dropProbability:      config.DropProbability,
+		duplicateProbability: config.DuplicateProbability,
+		stallProbability:     config.StallProbability,
+		closeProbability:     config.CloseProbability,
+		stallDuration:        config.StallDuration,
+		schedule:             config.Schedule,
+		rand:                 rand.New(rand.NewSource(config.Seed)),
+	}
+	if f.stallDuration == 0 {
+		f.stallDuration = defaultFaultStallDuration
+	}
+	return f
+}
+
+func (f *faultInjector) float64() float64 {
+	f.randMu.Lock()
+	defer f.randMu.Unlock()
+	return f.rand.Float64()
+}
+
+func (f *faultInjector) delay() time.Duration {
+	d := f.latency
+	if f.jitter > 0 {
+		f.randMu.Lock()
+		d += time.Duration(f.rand.Int63n(int64(f.jitter)))
+		f.randMu.Unlock()
+	}
+	return d
+}
+
+func (f *faultInjector) decide(transportName string, n int, packet *parser.Packet) Fault {
+	if f.schedule != nil {
+		return f.schedule(transportName, n, packet)
+	}
+	r := f.float64()
+	for _, c := range []struct {
+		probability float64
+		fault       Fault
+	}{
+		{f.closeProbability, FaultClose},
+		{f.dropProbability, FaultDrop},
+		{f.stallProbability, FaultStall},
+		{f.duplicateProbability, FaultDuplicate},
+	} {
+		if r < c.probability {
+			return c.fault
+		}
+		r -= c.probability
+	}
+	return FaultNone
+}
+
+// Send the packets with the faults applied. close is run on a new goroutine.
+//
+// n is the number of the packets sent on the transport before this call.
+func (f *faultInjector) send(
+	transportName string,
+	n int,
+	packets []*parser.Packet,
+	send func(packets ...*parser.Packet),
+	close func(),
+) {
+	delay := f.delay()
+	out := make([]*parser.Packet, 0, len(packets))
+	for i, packet := range packets {
+		switch f.decide(transportName, n+i+1, packet) {
+		case FaultDrop:
+			continue
+		case FaultClose:
+			time.Sleep(delay)
+			go close()
+			return
+		case FaultStall:
+			delay += f.stallDuration
+		case FaultDuplicate:
+			out = append(out, packet)
+		}
+		out = append(out, packet)
+	}
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if len(out) > 0 {
+		send(out...)
+	}
+}
+
+// Wrap t so that the faults configured with config are injected into the packets it sends.
+// This can be used to inject faults into a custom transport (see: RegisterServerTransport).
+//
+// Each call creates its own random number generator (seeded with config.Seed).
+// If config is nil, t is returned as it is.
+func WrapServerTransport(t ServerTransport, config *FaultInjectionConfig) ServerTransport {
+	return newFaultInjector(config).wrapServerTransport(t)
+}
+
+// Wrap t so that the faults configured with config are injected into the packets it sends.
+// This can be used to inject faults into a custom transport (see: RegisterClientTransport).
+//
+// Each call creates its own random number generator (seeded with config.Seed).
+// If config is nil, t is returned as it is.
+func WrapClientTransport(t ClientTransport, config *FaultInjectionConfig) ClientTransport {
+	return newFaultInjector(config).wrapClientTransport(t)
+}
+
+func (f *faultInjector) wrapServerTransport(t ServerTransport) ServerTransport {
+	if f == nil {
+		return t
+	}
+	return &faultyServerTransport{ServerTransport: t, f: f}
+}
+
+func (f *faultInjector) wrapClientTransport(t ClientTransport) ClientTransport {
+	if f == nil {
+		return t
+	}
+	return &faultyClientTransport{ClientTransport: t, f: f}
+}
+
+type faultyServerTransport struct {
+	ServerTransport
+	f *faultInjector
+
+	n  int
+	mu sync.Mutex
+}
+
+func (t *faultyServerTransport) Send(packets ...*parser.Packet) {
+	t.mu.Lock()
+	n := t.n
+	t.n += len(packets)
+	t.mu.Unlock()
+	t.f.send(t.Name(), n, packets, t.ServerTransport.Send, t.ServerTransport.Close)
+}
+
+type faultyClientTransport struct {
+	ClientTransport
+	f *faultInjector
+
+	n  int
+	mu sync.Mutex
+}
+
+func (t *faultyClientTransport) Send(packets ...*parser.Packet) {
+	t.mu.Lock()
+	n := t.n
+	t.n += len(packets)
+	t.mu.Unlock()
+	t.f.send(t.Name(), n, packets, t.ClientTransport.Send, t.ClientTransport.Close)
+}
@@ -0,0 +1,188 @@
+package eio
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomruk/socket.io-go/engine.io/parser"
+)
+
+func TestFaultInjection(t *testing.T) {
+	t.Run("should produce the same faults with the same seed", func(t *testing.T) {
+		config := &FaultInjectionConfig{
+			DropProbability:      0.2,
+			DuplicateProbability: 0.2,
+			StallProbability:     0.2,
+			CloseProbability:     0.2,
+			Seed:                 42,
+		}
+		a := newFaultInjector(config)
+		b := newFaultInjector(config)
+
+		seen := make(map[Fault]bool)
+		for i := 1; i <= 100; i++ {
+			fault := a.decide("polling", i, nil)
+			require.Equal(t, fault, b.decide("polling", i, nil))
+			seen[fault] = true
+		}
+		for _, fault := range []Fault{FaultNone, FaultDrop, FaultDuplicate, FaultStall, FaultClose} {
+			assert.True(t, seen[fault], "fault %d is never produced", fault)
+		}
+	})
+
+	t.Run("should not wrap the transports if the config is nil", func(t *testing.T) {
+		f := newFaultInjector(nil)
+		require.Nil(t, f)
+
+		tr := newTestServerTransport()
+		require.Equal(t, tr, f.wrapServerTransport(tr))
+	})
+
+	t.Run("`WrapServerTransport` should inject the faults into the wrapped transport", func(t *testing.T) {
+		tr := &recordingServerTransport{testServerTransport: newTestServerTransport()}
+		require.Equal(t, ServerTransport(tr), WrapServerTransport(tr, nil))
+
+		wrapped := WrapServerTransport(tr, &FaultInjectionConfig{
+			Schedule: func(transportName string, n int, packet *parser.Packet) Fault {
+				switch n {
+				case 1:
+					return FaultDrop
+				case 2:
+					return FaultDuplicate
+				}
+				return FaultNone
+			},
+		})
+		wrapped.Send(
+			mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("1")),
+			mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("2")),
+			mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("3")),
+		)
+		require.Equal(t, []string{"2", "2", "3"}, tr.sent)
+	})
+
+	t.Run("should drop and duplicate the packets according to the schedule", func(t *testing.T) {
+		tw := NewTestWaiter(3)
+
+		var received []string
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnPacket: func(packets ...*parser.Packet) {
+					for _, packet := range packets {
+						if packet.Type == parser.PacketTypeMessage {
+							received = append(received, string(packet.Data))
+							tw.Done()
+						}
+					}
+				},
+			}
+		}, nil, nil)
+		err := io.Run()
+		require.NoError(t, err)
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		schedule := func(transportName string, n int, packet *parser.Packet) Fault {
+			switch string(packet.Data) {
+			case "2":
+				return FaultDrop
+			case "3":
+				return FaultDuplicate
+			}
+			return FaultNone
+		}
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports:     []string{"websocket"},
+			FaultInjection: &FaultInjectionConfig{Schedule: schedule},
+		}, nil)
+		defer socket.Close()
+
+		for _, data := range []string{"1", "2", "3"} {
+			socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte(data)))
+		}
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+		assert.Equal(t, []string{"1", "3", "3"}, received)
+	})
+
+	t.Run("should close the transport according to the schedule", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("close")))
+			return nil
+		}, &ServerConfig{
+			FaultInjection: &FaultInjectionConfig{
+				Schedule: func(transportName string, n int, packet *parser.Packet) Fault {
+					if string(packet.Data) == "close" {
+						return FaultClose
+					}
+					return FaultNone
+				},
+			},
+		}, nil)
+		err := io.Run()
+		require.NoError(t, err)
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		testDial(t, s.URL, &Callbacks{
+			OnPacket: func(packets ...*parser.Packet) {
+				for _, packet := range packets {
+					assert.NotEqual(t, "close", string(packet.Data))
+				}
+			},
+			OnClose: func(reason Reason, err error) {
+				tw.Done()
+			},
+		}, &ClientConfig{Transports: []string{"websocket"}}, nil)
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("should delay the packets with `Latency`", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+		latency := 100 * time.Millisecond
+
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnPacket: func(packets ...*parser.Packet) {
+					for _, packet := range packets {
+						if packet.Type == parser.PacketTypeMessage {
+							tw.Done()
+						}
+					}
+				},
+			}
+		}, nil, nil)
+		err := io.Run()
+		require.NoError(t, err)
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports:     []string{"websocket"},
+			FaultInjection: &FaultInjectionConfig{Latency: latency},
+		}, nil)
+		defer socket.Close()
+
+		start := time.Now()
+		socket.Send(mustCreatePacket(t, parser.PacketTypeMessage, false, []byte("hello")))
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+		assert.GreaterOrEqual(t, time.Since(start), latency)
+	})
+}
+
+type recordingServerTransport struct {
+	*testServerTransport
+	sent []string
+}
+
+func (t *recordingServerTransport) Send(packets ...*parser.Packet) {
+	for _, packet := range packets {
+		t.sent = append(t.sent, string(packet.Data))
+	}
+}
@@ -0,0 +1,65 @@
+package eio
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Information about the request that established the connection (the handshake request).
+//
+// This is the equivalent of `socket.request` in original Engine.IO,
+// and the equivalent of `socket.handshake` in original Socket.IO.
+type Handshake struct {
+	// Headers of the request.
+	Headers http.Header
+
+	// Query parameters of the request.
+	Query url.Values
+
+	// URL of the request.
+	URL string
+
+	// IP address of the client.
+	//
+	// If the request is from a trusted proxy (see ConnectionLimitsConfig.TrustedProxies),
+	// this is the client IP address taken from the X-Forwarded-For header.
+	Address string
+
+	// Network address of the peer that sent the request (http.Request.RemoteAddr).
+	RemoteAddr string
+
+	// Whether the connection is secure (TLS).
+	Secure bool
+
+	// TLS state of the connection. This is nil if the connection is not secure.
+	TLS *tls.ConnectionState
+
+	// Whether the request is cross-domain (the Origin header is set).
+	XDomain bool
+
+	// Time of the handshake.
+	Issued time.Time
+}
+
+func newHandshake(r *http.Request, address string) *Handshake {
+	return &Handshake{
+		Headers:    r.Header.Clone(),
+		Query:      r.URL.Query(),
+		URL:        r.URL.String(),
+		Address:    address,
+		RemoteAddr: r.RemoteAddr,
+		Secure:     r.TLS != nil,
+		TLS:        r.TLS,
+		XDomain:    r.Header.Get("Origin") != "",
+		Issued:     time.Now(),
+	}
+}
+
+// Return the named cookie sent with the handshake request.
+// If the cookie is not found, http.ErrNoCookie is returned.
+func (h *Handshake) Cookie(name string) (*http.Cookie, error) {
+	r := http.Request{Header: h.Headers}
+	return r.Cookie(name)
+}
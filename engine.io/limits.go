@@ -0,0 +1,230 @@
+package eio
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tomruk/socket.io-go/internal/sync"
+)
+
+// Configuration of the connection limits (load shedding).
+//
+// When a limit is exceeded, the handshake is rejected with 503 (Service Unavailable)
+// and the Retry-After header is set. Established connections are not affected.
+type ConnectionLimitsConfig struct {
+	// Maximum number of concurrent connections.
+	//
+	// Default: 0 (unlimited)
+	MaxConnections int
+
+	// Maximum number of concurrent connections per client IP address.
+	//
+	// Default: 0 (unlimited)
+	MaxConnectionsPerIP int
+
+	// IP addresses or CIDR ranges (e.g. "10.0.0.0/8") of the trusted reverse proxies.
+	//
+	// If a request comes from a trusted proxy, the client IP address is taken from the X-Forwarded-For header.
+	// The rightmost address of the header that is not a trusted proxy is used as the client IP address.
+	// Otherwise, the remote address of the request is used.
+	TrustedProxies []string
+
+	// Called on every handshake request.
+	// Return true to reject the handshake (e.g. when the CPU or memory usage is too high).
+	IsOverloaded ServerOverloadFunc
+
+	// Value of the Retry-After header of the rejected handshakes. It is rounded up to seconds.
+	//
+	// Default: 5 seconds
+	RetryAfter time.Duration
+}
+
+// Counters of the connection limits.
+type ConnectionLimitsStats struct {
+	// Number of the current connections.
+	Connections int
+
+	// Number of the handshakes rejected due to MaxConnections.
+	RejectedMaxConnections uint64
+	// Number of the handshakes rejected due to MaxConnectionsPerIP.
+	RejectedMaxConnectionsPerIP uint64
+	// Number of the handshakes rejected due to IsOverloaded.
+	RejectedOverloaded uint64
+}
+
+type connLimiter struct {
+	maxConnections      int
+	maxConnectionsPerIP int
+	trustedProxies      []string
+	trustedPrefixes     []netip.Prefix
+	isOverloaded        ServerOverloadFunc
+	retryAfter          time.Duration
+
+	connections int
+	perIP       map[string]int
+	mu          sync.Mutex
+
+	rejectedMaxConnections      atomic.Uint64
+	rejectedMaxConnectionsPerIP atomic.Uint64
+	rejectedOverloaded          atomic.Uint64
+}
+
+// config can be nil.
+func newConnLimiter(config *ConnectionLimitsConfig) *connLimiter {
+	if config == nil {
+		config = new(ConnectionLimitsConfig)
+	}
+
+	l := &connLimiter{
+		maxConnections:      config.MaxConnections,
+		maxConnectionsPerIP: config.MaxConnectionsPerIP,
+		trustedProxies:      config.TrustedProxies,
+		isOverloaded:        config.IsOverloaded,
+		retryAfter:          config.RetryAfter,
+		perIP:               make(map[string]int),
+	}
+
+	if l.isOverloaded == nil {
+		l.isOverloaded = func(r *http.Request) (overloaded bool) { return false }
+	}
+	if l.retryAfter <= 0 {
+		l.retryAfter = defaultRetryAfter
+	}
+	return l
+}
+
+// Parse the trusted proxies. This is called by Server.Run.
+func (l *connLimiter) init() error {
+	l.trustedPrefixes = make([]netip.Prefix, 0, len(l.trustedProxies))
+	for _, proxy := range l.trustedProxies {
+		var prefix netip.Prefix
+		if strings.Contains(proxy, "/") {
+			p, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return fmt.Errorf("eio: invalid trusted proxy: %w", err)
+			}
+			prefix = p.Masked()
+		} else {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return fmt.Errorf("eio: invalid trusted proxy: %w", err)
+			}
+			addr = addr.Unmap()
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		l.trustedPrefixes = append(l.trustedPrefixes, prefix)
+	}
+	return nil
+}
+
+func (l *connLimiter) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l.trustedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the IP address of the client that made the request r.
+func (l *connLimiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !l.isTrustedProxy(addr) {
+		return host
+	}
+
+	var ips []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		ips = append(ips, strings.Split(header, ",")...)
+	}
+
+	// Walk from the nearest proxy to the client.
+	// The first address that is not a trusted proxy is the client.
+	ip := host
+	for i := len(ips) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(ips[i]))
+		if err != nil {
+			// The addresses to the left of an invalid address cannot be trusted.
+			break
+		}
+		ip = addr.Unmap().String()
+		if !l.isTrustedProxy(addr) {
+			break
+		}
+	}
+	return ip
+}
+
+// Reserve a connection slot for the request r.
+// If ok is true, the slot must be released with release(ip) when the connection is closed.
+func (l *connLimiter) acquire(r *http.Request) (ip string, ok bool) {
+	ip = l.clientIP(r)
+
+	if l.isOverloaded(r) {
+		l.rejectedOverloaded.Add(1)
+		return ip, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxConnections > 0 && l.connections >= l.maxConnections {
+		l.rejectedMaxConnections.Add(1)
+		return ip, false
+	}
+	if l.maxConnectionsPerIP > 0 && l.perIP[ip] >= l.maxConnectionsPerIP {
+		l.rejectedMaxConnectionsPerIP.Add(1)
+		return ip, false
+	}
+
+	l.connections++
+	if l.maxConnectionsPerIP > 0 {
+		l.perIP[ip]++
+	}
+	return ip, true
+}
+
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.connections--
+	if l.maxConnectionsPerIP > 0 {
+		l.perIP[ip]--
+		if l.perIP[ip] <= 0 {
+			delete(l.perIP, ip)
+		}
+	}
+}
+
+func (l *connLimiter) writeServiceUnavailable(w http.ResponseWriter) {
+	retryAfter := int(math.Ceil(l.retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func (l *connLimiter) stats() ConnectionLimitsStats {
+	l.mu.Lock()
+	connections := l.connections
+	l.mu.Unlock()
+
+	return ConnectionLimitsStats{
+		Connections:                 connections,
+		RejectedMaxConnections:      l.rejectedMaxConnections.Load(),
+		RejectedMaxConnectionsPerIP: l.rejectedMaxConnectionsPerIP.Load(),
+		RejectedOverloaded:          l.rejectedOverloaded.Load(),
+	}
+}
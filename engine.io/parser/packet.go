@@ -48,6 +48,11 @@ type Packet struct {
 	IsBinary bool
 	Type     PacketType
 	Data     []byte
+
+	// This is not a part of the encoded packet.
+	// If this is set, the websocket transport will not compress the packet,
+	// and the polling transport will not compress a response that only consists of packets with this field set.
+	SkipCompression bool
 }
 
 func NewPacket(packetType PacketType, isBinary bool, data []byte) (*Packet, error) {
@@ -1,3 +1,6 @@
 package parser
 
 const ProtocolVersion = 4
+
+// Engine.IO protocol v3. This is used by the Socket.IO v2 clients.
+const ProtocolVersion3 = 3
@@ -1,11 +1,20 @@
 package parser
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
 )
 
 const payloadDelimiter byte = 30
 
+var (
+	ErrPacketTooLarge  = fmt.Errorf("parser: packet size limit exceeded")
+	ErrPayloadTooLarge = fmt.Errorf("parser: payload size limit exceeded")
+)
+
 // `packets` must not be nil.
 func EncodedPayloadsLen(packets ...*Packet) int {
 	l := 0
@@ -45,44 +54,89 @@ func EncodePayloads(w io.Writer, packets ...*Packet) error {
 	return nil
 }
 
-func splitByte(buf []byte, delim byte) [][]byte {
-	buffers := make([][]byte, 0, 1)
+func DecodePayloads(r io.Reader) ([]*Packet, error) {
+	return NewPayloadDecoder(r, 0, 0).DecodeAll()
+}
 
-	last := 0
-	for i, c := range buf {
-		if c == delim {
-			if i == len(buf) {
-				buffers = append(buffers, []byte{})
-			} else {
-				buffers = append(buffers, buf[last:i])
-			}
-			last = i + 1
-		}
-	}
+// Decode the packets of a payload one by one, as they are read from the reader.
+//
+// The payload is not read into memory as a whole. Only the packet that is being decoded is buffered,
+// and the buffer is reused for the next packet.
+type PayloadDecoder struct {
+	r              *bufio.Reader
+	maxPacketSize  int64
+	maxPayloadSize int64
+
+	read int64
+	buf  []byte
+	done bool
+}
 
-	if len(buffers) == 0 {
-		buffers = append(buffers, buf)
-	} else if last <= len(buf) {
-		buffers = append(buffers, buf[last:])
+// maxPacketSize is the maximum size of an encoded packet and maxPayloadSize is the maximum size of the payload.
+// If a limit is exceeded, ErrPacketTooLarge or ErrPayloadTooLarge is returned. 0 means unlimited.
+func NewPayloadDecoder(r io.Reader, maxPacketSize, maxPayloadSize int64) *PayloadDecoder {
+	return &PayloadDecoder{
+		r:              bufio.NewReader(r),
+		maxPacketSize:  maxPacketSize,
+		maxPayloadSize: maxPayloadSize,
 	}
-	return buffers
 }
 
-func DecodePayloads(r io.Reader) ([]*Packet, error) {
-	packets := make([]*Packet, 0, 1) // Minimum 1 packet expected
-	buf, err := io.ReadAll(r)
-	if err != nil {
-		return nil, err
+// Decode the next packet. If there are no more packets, io.EOF is returned.
+func (d *PayloadDecoder) Decode() (*Packet, error) {
+	if d.done {
+		return nil, io.EOF
 	}
 
-	splitted := splitByte(buf, payloadDelimiter)
+	d.buf = d.buf[:0]
+	for {
+		chunk, err := d.r.ReadSlice(payloadDelimiter)
+		d.read += int64(len(chunk))
+		if err == nil {
+			// Strip the delimiter.
+			chunk = chunk[:len(chunk)-1]
+		}
+		// If both limits are exceeded, report the packet.
+		if d.maxPacketSize > 0 && int64(len(d.buf)+len(chunk)) > d.maxPacketSize {
+			d.done = true
+			return nil, ErrPacketTooLarge
+		}
+		if d.maxPayloadSize > 0 && d.read > d.maxPayloadSize {
+			d.done = true
+			return nil, ErrPayloadTooLarge
+		}
+		d.buf = append(d.buf, chunk...)
+
+		if err == nil {
+			break
+		} else if errors.Is(err, io.EOF) {
+			d.done = true
+			break
+		} else if !errors.Is(err, bufio.ErrBufferFull) {
+			d.done = true
+			return nil, err
+		}
+	}
+
+	// The data of a text packet refers to the buffer it is decoded from.
+	// Copy the buffer, since it is reused for the next packet.
+	if len(d.buf) > 0 && d.buf[0] != base64Prefix {
+		return decode(bytes.Clone(d.buf), false)
+	}
+	return decode(d.buf, false)
+}
 
-	for _, sp := range splitted {
-		packet, err := decode(sp, false)
+// Decode the rest of the packets.
+func (d *PayloadDecoder) DecodeAll() ([]*Packet, error) {
+	packets := make([]*Packet, 0, 1) // Minimum 1 packet expected
+	for {
+		packet, err := d.Decode()
 		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return packets, nil
+			}
 			return nil, err
 		}
 		packets = append(packets, packet)
 	}
-	return packets, nil
 }
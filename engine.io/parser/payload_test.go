@@ -2,7 +2,11 @@ package parser
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"strconv"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/require"
 )
@@ -46,74 +50,6 @@ func TestEncodeDecodePayloads(t *testing.T) {
 	}
 }
 
-func TestSplitByte(t *testing.T) {
-	const delim byte = '|'
-
-	tests := [][]byte{
-		[]byte(""),
-		[]byte("|"),
-		[]byte("|||"),
-		[]byte("123|"),
-		[]byte("|123"),
-		[]byte("123"),
-		[]byte("123|456"),
-		[]byte("123|456|789"),
-	}
-
-	expected := [][][]byte{
-		{
-			[]byte(""),
-		},
-		{
-			[]byte(""),
-			[]byte(""),
-		},
-		{
-			[]byte(""),
-			[]byte(""),
-			[]byte(""),
-			[]byte(""),
-		},
-		{
-			[]byte("123"),
-			[]byte(""),
-		},
-		{
-			[]byte(""),
-			[]byte("123"),
-		},
-		{
-			[]byte("123"),
-		},
-		{
-			[]byte("123"),
-			[]byte("456"),
-		},
-		{
-			[]byte("123"),
-			[]byte("456"),
-			[]byte("789"),
-		},
-	}
-
-	for i, test := range tests {
-		splitted := splitByte(test, delim)
-		for _i, s := range splitted {
-			t.Logf("splitted[%d]: %s", _i, s)
-		}
-		t.Logf("\n")
-
-		require.Equal(t, len(expected[i]), len(splitted), "expected and splitted should be equal")
-
-		for j, e := range expected[i] {
-			if !bytes.Equal(splitted[j], e) {
-				t.Fatal("test and expected should match")
-			}
-		}
-	}
-
-}
-
 func TestDecodeSinglePayload(t *testing.T) {
 	test := mustCreatePacket(t, PacketTypeMessage, true, []byte{0x0, 0x1, 0x2, 0x3})
 
@@ -161,3 +97,73 @@ func TestDecodeInvalidPayload(t *testing.T) {
 		t.Fatal("errInvalidPacketType expected")
 	}
 }
+
+func TestPayloadDecoder(t *testing.T) {
+	t.Run("should decode the packets one by one", func(t *testing.T) {
+		var test []*Packet
+		for i := 0; i < 1000; i++ {
+			test = append(test, mustCreatePacket(t, PacketTypeMessage, i%2 == 0, []byte(strconv.Itoa(i))))
+		}
+
+		buf := bytes.NewBuffer(nil)
+		err := EncodePayloads(buf, test...)
+		require.NoError(t, err)
+
+		d := NewPayloadDecoder(iotest.OneByteReader(buf), 8, 0)
+		var packets []*Packet
+		for {
+			packet, err := d.Decode()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			packets = append(packets, packet)
+		}
+
+		require.Equal(t, len(test), len(packets))
+		for i, packet := range packets {
+			require.Equal(t, test[i].Type, packet.Type)
+			require.Equal(t, test[i].IsBinary, packet.IsBinary)
+			require.Equal(t, test[i].Data, packet.Data)
+		}
+	})
+
+	t.Run("should return `ErrPacketTooLarge` if a packet exceeds the limit", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		err := EncodePayloads(buf,
+			mustCreatePacket(t, PacketTypeMessage, false, []byte("1234")),
+			mustCreatePacket(t, PacketTypeMessage, false, []byte("12345")),
+		)
+		require.NoError(t, err)
+
+		d := NewPayloadDecoder(buf, 5, 0)
+		packet, err := d.Decode()
+		require.NoError(t, err)
+		require.Equal(t, []byte("1234"), packet.Data)
+
+		_, err = d.Decode()
+		require.ErrorIs(t, err, ErrPacketTooLarge)
+		_, err = d.Decode()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("should return `ErrPayloadTooLarge` if the payload exceeds the limit", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		err := EncodePayloads(buf,
+			mustCreatePacket(t, PacketTypeMessage, false, []byte("1234")),
+			mustCreatePacket(t, PacketTypeMessage, false, []byte("1234")),
+		)
+		require.NoError(t, err)
+
+		_, err = NewPayloadDecoder(buf, 5, 10).DecodeAll()
+		require.ErrorIs(t, err, ErrPayloadTooLarge)
+	})
+
+	t.Run("should return an error if the payload is empty or has a trailing delimiter", func(t *testing.T) {
+		_, err := NewPayloadDecoder(bytes.NewReader(nil), 0, 0).DecodeAll()
+		require.Error(t, err)
+
+		_, err = NewPayloadDecoder(bytes.NewReader([]byte{'4', 'a', payloadDelimiter}), 0, 0).DecodeAll()
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// This file implements the Engine.IO protocol v3 (see ProtocolVersion3).
+//
+// Differences from the protocol v4:
+//   - Payloads are length-prefixed (`<length>:<packet>`) instead of being separated by a delimiter.
+//     If the client supports binary and there are binary packets, the binary payload format is used instead.
+//   - Binary packets contain the packet type: as a byte in binary frames, and after the `b` in base64 encoded packets.
+
+const (
+	binaryPayloadString byte = 0
+	binaryPayloadBinary byte = 1
+	binaryPayloadSep    byte = 255
+)
+
+var errInvalidPayload = fmt.Errorf("parser: invalid payload")
+
+func (p *Packet) EncodedLenV3(supportsBinary bool) int {
+	if p.IsBinary {
+		if supportsBinary {
+			return 1 + len(p.Data)
+		} else {
+			return 2 + base64.StdEncoding.EncodedLen(len(p.Data))
+		}
+	}
+	return 1 + len(p.Data)
+}
+
+// Note: Writer should either implement io.ByteWriter
+// or should not have a problem with writing 1 byte at a time.
+func (p *Packet) EncodeV3(w io.Writer, supportsBinary bool) error {
+	if !p.IsBinary {
+		return p.Encode(w, supportsBinary)
+	}
+
+	bw, ok := w.(io.ByteWriter)
+	if !ok {
+		bw = byteWriter{w: w}
+	}
+
+	if supportsBinary {
+		err := bw.WriteByte(byte(p.Type))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(p.Data)
+		return err
+	}
+
+	err := bw.WriteByte(base64Prefix)
+	if err != nil {
+		return err
+	}
+	err = bw.WriteByte(p.Type.ToChar())
+	if err != nil {
+		return err
+	}
+
+	encoder := base64.NewEncoder(base64.StdEncoding, w)
+	defer encoder.Close()
+
+	_, err = encoder.Write(p.Data)
+	return err
+}
+
+func DecodeV3(r io.Reader, binaryFrame bool) (*Packet, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeV3(buf, binaryFrame)
+}
+
+func decodeV3(data []byte, binaryFrame bool) (*Packet, error) {
+	if binaryFrame {
+		if len(data) < 1 {
+			return nil, errInvalidPacketSize
+		}
+		// Binary packets can only be messages.
+		if PacketType(data[0]) != PacketTypeMessage {
+			return nil, errInvalidPacketType
+		}
+		return &Packet{
+			IsBinary: true,
+			Type:     PacketTypeMessage,
+			Data:     data[1:],
+		}, nil
+	}
+
+	if len(data) >= 1 && data[0] == base64Prefix {
+		if len(data) < 2 {
+			return nil, errInvalidPacketSize
+		}
+		if data[1] != PacketTypeMessage.ToChar() {
+			return nil, errInvalidPacketType
+		}
+
+		data = data[2:]
+		packet := &Packet{
+			IsBinary: true,
+			Type:     PacketTypeMessage,
+			Data:     make([]byte, base64.StdEncoding.DecodedLen(len(data))),
+		}
+		n, err := base64.StdEncoding.Decode(packet.Data, data)
+		if err != nil {
+			return nil, err
+		}
+		packet.Data = packet.Data[:n]
+		return packet, nil
+	}
+	return decode(data, false)
+}
+
+// Return true if at least one of the packets is binary.
+func HasBinary(packets ...*Packet) bool {
+	for _, packet := range packets {
+		if packet.IsBinary {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode the packets as an Engine.IO v3 payload.
+//
+// If binaryPayload is true, the binary payload format is used.
+// Otherwise the text payload format is used and the binary packets are base64 encoded.
+// Use the binary payload format only if the client supports binary and there are binary packets (see HasBinary).
+func EncodePayloadsV3(w io.Writer, binaryPayload bool, packets ...*Packet) error {
+	buf := bytes.Buffer{}
+	for _, packet := range packets {
+		buf.Reset()
+		err := packet.EncodeV3(&buf, binaryPayload)
+		if err != nil {
+			return err
+		}
+
+		if binaryPayload {
+			// <0 for string, 1 for binary><length, each digit as a byte><255><packet>
+			header := make([]byte, 0, 22)
+			if packet.IsBinary {
+				header = append(header, binaryPayloadBinary)
+			} else {
+				header = append(header, binaryPayloadString)
+			}
+			for _, c := range strconv.Itoa(buf.Len()) {
+				header = append(header, byte(c-'0'))
+			}
+			header = append(header, binaryPayloadSep)
+
+			_, err = w.Write(header)
+		} else {
+			// The length is the length of the JavaScript string (in UTF-16 code units).
+			_, err = io.WriteString(w, strconv.Itoa(utf16Len(buf.Bytes()))+":")
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode an Engine.IO v3 payload. binaryPayload should be true if the payload
+// was sent with the binary payload format (Content-Type: application/octet-stream).
+func DecodePayloadsV3(r io.Reader, binaryPayload bool) ([]*Packet, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, errInvalidPayload
+	}
+
+	packets := make([]*Packet, 0, 1) // Minimum 1 packet expected
+	for len(buf) > 0 {
+		var (
+			n           int
+			binaryFrame bool
+		)
+
+		if binaryPayload {
+			switch buf[0] {
+			case binaryPayloadString:
+			case binaryPayloadBinary:
+				binaryFrame = true
+			default:
+				return nil, errInvalidPayload
+			}
+			buf = buf[1:]
+
+			i := 0
+			for ; i < len(buf) && buf[i] != binaryPayloadSep; i++ {
+				if buf[i] > 9 {
+					return nil, errInvalidPayload
+				}
+				n = n*10 + int(buf[i])
+				if n > len(buf) {
+					return nil, errInvalidPayload
+				}
+			}
+			if i == 0 || i == len(buf) {
+				return nil, errInvalidPayload
+			}
+			buf = buf[i+1:]
+			if n > len(buf) {
+				return nil, errInvalidPayload
+			}
+		} else {
+			i := bytes.IndexByte(buf, ':')
+			if i < 1 {
+				return nil, errInvalidPayload
+			}
+			length, err := strconv.Atoi(string(buf[:i]))
+			if err != nil || length < 0 {
+				return nil, errInvalidPayload
+			}
+			buf = buf[i+1:]
+
+			var ok bool
+			n, ok = utf16Offset(buf, length)
+			if !ok {
+				return nil, errInvalidPayload
+			}
+		}
+
+		packet, err := decodeV3(buf[:n], binaryFrame)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, packet)
+		buf = buf[n:]
+	}
+	return packets, nil
+}
+
+// Return the length of the UTF-8 encoded text in UTF-16 code units.
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// Return the byte offset of the UTF-8 encoded text that is n UTF-16 code units long.
+func utf16Offset(b []byte, n int) (offset int, ok bool) {
+	for n > 0 {
+		if offset == len(b) {
+			return 0, false
+		}
+		r, size := utf8.DecodeRune(b[offset:])
+		offset += size
+		if r >= 0x10000 {
+			n -= 2
+		} else {
+			n--
+		}
+	}
+	return offset, n == 0
+}
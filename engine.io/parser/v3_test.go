@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecodePacketsV3(t *testing.T) {
+	test := []*Packet{
+		mustCreatePacket(t, PacketTypePing, false, []byte("probe")),
+		mustCreatePacket(t, PacketTypeMessage, false, []byte("testing123")),
+		mustCreatePacket(t, PacketTypeMessage, true, []byte{0x0, 0x1, 0x2, 0x3}),
+	}
+
+	for _, supportsBinary := range []bool{true, false} {
+		for _, p1 := range test {
+			buf := bytes.Buffer{}
+			err := p1.EncodeV3(&buf, supportsBinary)
+			require.NoError(t, err)
+			require.Equal(t, p1.EncodedLenV3(supportsBinary), buf.Len())
+
+			p2, err := DecodeV3(&buf, p1.IsBinary && supportsBinary)
+			require.NoError(t, err)
+			require.Equal(t, p1.Type, p2.Type, "packet type doesn't match")
+			require.Equal(t, p1.IsBinary, p2.IsBinary, "isBinary doesn't match")
+			require.Equal(t, p1.Data, p2.Data, "packet data doesn't match")
+		}
+	}
+
+	t.Run("binary packets should contain the packet type", func(t *testing.T) {
+		p := mustCreatePacket(t, PacketTypeMessage, true, []byte{0x1, 0x2})
+
+		buf := bytes.Buffer{}
+		err := p.EncodeV3(&buf, true)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x4, 0x1, 0x2}, buf.Bytes())
+
+		buf.Reset()
+		err = p.EncodeV3(&buf, false)
+		require.NoError(t, err)
+		require.Equal(t, "b4AQI=", buf.String())
+	})
+}
+
+func TestEncodeDecodePayloadsV3(t *testing.T) {
+	test := []*Packet{
+		mustCreatePacket(t, PacketTypeOpen, false, nil),
+		mustCreatePacket(t, PacketTypePing, false, []byte("testing123")),
+		mustCreatePacket(t, PacketTypeMessage, false, []byte("€ and 😀")),
+		mustCreatePacket(t, PacketTypeMessage, true, []byte{0x0, 0x1, 0x2, 0x3}),
+		mustCreatePacket(t, PacketTypeNoop, false, nil),
+	}
+
+	for _, binaryPayload := range []bool{true, false} {
+		buf := bytes.Buffer{}
+		err := EncodePayloadsV3(&buf, binaryPayload, test...)
+		require.NoError(t, err)
+
+		packets, err := DecodePayloadsV3(&buf, binaryPayload)
+		require.NoError(t, err)
+		require.Equal(t, len(test), len(packets))
+
+		for i, p1 := range packets {
+			p2 := test[i]
+			require.Equal(t, p2.Type, p1.Type, "packet type doesn't match")
+			require.Equal(t, p2.IsBinary, p1.IsBinary, "isBinary doesn't match")
+			require.True(t, bytes.Equal(p1.Data, p2.Data), "packet data doesn't match")
+		}
+	}
+
+	t.Run("text payload lengths should be in UTF-16 code units", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		err := EncodePayloadsV3(&buf, false,
+			mustCreatePacket(t, PacketTypeMessage, false, []byte("😀")),
+			mustCreatePacket(t, PacketTypeMessage, true, []byte{0x1}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, "3:4😀6:b4AQ==", buf.String())
+	})
+
+	t.Run("binary payload should be encoded as expected", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		err := EncodePayloadsV3(&buf, true,
+			mustCreatePacket(t, PacketTypeMessage, false, []byte("hello")),
+			mustCreatePacket(t, PacketTypeMessage, true, []byte{0x1}),
+		)
+		require.NoError(t, err)
+
+		expected := []byte{0, 6, 255, '4', 'h', 'e', 'l', 'l', 'o', 1, 2, 255, 4, 1}
+		require.Equal(t, expected, buf.Bytes())
+	})
+
+	t.Run("should fail with invalid payloads", func(t *testing.T) {
+		invalidTextPayloads := []string{"", "4", ":4", "x:4", "5:4abc", "2:4😀"}
+		for _, payload := range invalidTextPayloads {
+			_, err := DecodePayloadsV3(bytes.NewBufferString(payload), false)
+			require.Error(t, err, "payload: %s", payload)
+		}
+
+		invalidBinaryPayloads := [][]byte{
+			{},
+			{2, 1, 255, '4'},
+			{0, 255, '4'},
+			{0, 1},
+			{0, 5, 255, '4'},
+			{0, 10, 255, '4'},
+		}
+		for _, payload := range invalidBinaryPayloads {
+			_, err := DecodePayloadsV3(bytes.NewBuffer(payload), true)
+			require.Error(t, err, "payload: %v", payload)
+		}
+	})
+}
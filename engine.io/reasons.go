@@ -8,4 +8,6 @@ const (
 	ReasonForcedClose    Reason = "forced close"
 	ReasonPingTimeout    Reason = "ping timeout"
 	ReasonParseError     Reason = "parse error"
+
+	ReasonServerShuttingDown Reason = "server shutting down"
 )
@@ -1,10 +1,16 @@
 package eio
 
 import (
+	"compress/flate"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"slices"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/webtransport-go"
@@ -12,9 +18,6 @@ import (
 
 	"github.com/tomruk/socket.io-go/engine.io/parser"
 	"github.com/tomruk/socket.io-go/engine.io/transport"
-	"github.com/tomruk/socket.io-go/engine.io/transport/polling"
-	_websocket "github.com/tomruk/socket.io-go/engine.io/transport/websocket"
-	_webtransport "github.com/tomruk/socket.io-go/engine.io/transport/webtransport"
 
 	"nhooyr.io/websocket"
 )
@@ -22,11 +25,45 @@ import (
 type (
 	ServerAuthFunc func(w http.ResponseWriter, r *http.Request) (ok bool)
 
+	// Return a non-nil error to reject the handshake.
+	//
+	// If the error is (or wraps) a *ServerError, it is sent to the client with the code, message and context it carries.
+	// Otherwise, ErrorForbidden is sent.
+	ServerAuthErrorFunc func(w http.ResponseWriter, r *http.Request) error
+
+	// Modify the response headers before they are written.
+	ServerHeadersFunc func(headers http.Header, r *http.Request)
+
+	// r is the request that established the connection (the handshake request).
+	ServerConnectionFunc func(socket ServerSocket, r *http.Request)
+
+	// err can be nil. Always do a nil check.
+	ServerConnectionCloseFunc func(socket ServerSocket, reason Reason, err error)
+
+	// r is the upgrade request. transportName is the name of the transport being upgraded to.
+	ServerUpgradeFunc func(socket ServerSocket, transportName string, r *http.Request)
+
+	// r is the upgrade request. transportName is the name of the transport being upgraded to.
+	ServerUpgradeErrorFunc func(socket ServerSocket, transportName string, r *http.Request, err error)
+
+	// r is the rejected request. err is the Engine.IO error sent to the client.
+	ServerConnectionErrorFunc func(r *http.Request, err *ServerError)
+
+	// Generate a session ID for the handshake request r.
+	ServerIDGeneratorFunc func(r *http.Request) (sid string, err error)
+
+	// Return true to reject the handshake request r with 503 (Service Unavailable).
+	ServerOverloadFunc func(r *http.Request) (overloaded bool)
+
 	ServerConfig struct {
 		// This is a middleware function to authenticate clients before doing the handshake.
 		// If this function returns false authentication will fail. Or else, the handshake will begin as usual.
 		Authenticator ServerAuthFunc
 
+		// This is the same as Authenticator, except that the handshake can be rejected with a custom error.
+		// This is run after Authenticator (if it is set).
+		AuthenticatorWithError ServerAuthErrorFunc
+
 		// When to send PING packets to clients.
 		PingInterval time.Duration
 
@@ -36,17 +73,148 @@ type (
 		// Timeout to wait while a client transport is being upgraded.
 		UpgradeTimeout time.Duration
 
+		// Transports to accept. Valid transports are: polling, websocket, webtransport, memory
+		// and the transports registered with RegisterServerTransport.
+		// Handshakes and upgrades with other transports are rejected with ErrorUnknownTransport.
+		//
+		// The order of this list is also the order of the upgrades sent in the handshake packet.
+		// For example, ["polling", "webtransport", "websocket"] advertises webtransport before websocket.
+		//
+		// Default value is: ["polling", "websocket"] (and "webtransport" if WebTransportServer is set)
+		//
+		// The memory transport is not enabled by default. Add "memory" to accept the clients
+		// in the same process. See the transport/memory package.
+		Transports []string
+
+		// Don't allow the clients to upgrade their transports.
+		// If this is set, the upgrades list in the handshake packet is empty.
+		//
+		// This is the equivalent of `allowUpgrades: false` in original Engine.IO.
+		DisableUpgrades bool
+
+		// When Shutdown is called, each socket is closed after a random delay within this window.
+		// This spreads the reconnects of the clients over time, so that a rolling restart doesn't
+		// cause all clients to reconnect (to the other servers) at once.
+		//
+		// Default: 0 (all sockets are closed at once)
+		ShutdownJitter time.Duration
+
 		// MaxBufferSize is used for preventing denial of service (DOS).
 		// This is the equivalent of `maxHTTPBufferSize` in original Engine.IO.
 		MaxBufferSize        int64
 		DisableMaxBufferSize bool
 
+		// Maximum size of a single packet in a polling payload (the body of a POST request).
+		// A payload can contain many packets, so this can be set lower than MaxBufferSize.
+		// This is ignored if DisableMaxBufferSize is set.
+		//
+		// Default: MaxBufferSize
+		MaxPacketSize int64
+
+		// Disable JSONP polling (the `j` query parameter).
+		// If this is set, JSONP requests are rejected with 400 (Bad request).
+		//
+		// This is the equivalent of `jsonp: false` in original Engine.IO.
+		DisableJSONP bool
+
+		// Accept the clients that use the Engine.IO protocol v3 (Socket.IO v2 clients).
+		// The protocol version of a socket can be retrieved with ServerSocket.ProtocolVersion.
+		//
+		// This is the equivalent of `allowEIO3` in original Engine.IO.
+		AllowEIO3 bool
+
 		// For accepting WebTransport connections
 		WebTransportServer *webtransport.Server
 
 		// Custom WebSocket options to use.
+		//
+		// If CORS is set, OriginPatterns is extended with the allowed origins.
 		WebSocketAcceptOptions *websocket.AcceptOptions
 
+		// Enable the permessage-deflate extension of the websocket transport.
+		// Leave it nil to disable compression.
+		//
+		// This is the equivalent of `perMessageDeflate` in original Engine.IO.
+		PerMessageDeflate *PerMessageDeflateConfig
+
+		// Enable gzip/deflate compression of the polling responses.
+		// The encoding is chosen based on the Accept-Encoding header of the request.
+		// Leave it nil to disable compression.
+		//
+		// This is the equivalent of `httpCompression` in original Engine.IO.
+		HTTPCompression *HTTPCompressionConfig
+
+		// Set a cookie containing the session ID on handshake.
+		// Leave it nil to not set a cookie.
+		//
+		// This is the equivalent of `cookie` in original Engine.IO.
+		Cookie *CookieConfig
+
+		// Limits of the concurrent connections. Leave it nil to not limit the connections.
+		//
+		// Use Server.ConnectionLimitsStats to see how many handshakes are rejected.
+		ConnectionLimits *ConnectionLimitsConfig
+
+		// Inject faults (latency, packet drop, etc.) into the packets sent to the clients.
+		// This is meant to be used for testing. Leave it nil to disable fault injection.
+		FaultInjection *FaultInjectionConfig
+
+		// CORS configuration. Leave it nil to disable CORS handling.
+		//
+		// This applies to both the polling requests (including preflight requests)
+		// and the Origin check of the WebSocket upgrade requests.
+		CORS *CORSConfig
+
+		// Called before the response headers of the handshake request are written.
+		//
+		// This is the equivalent of the `initial_headers` event in original Engine.IO.
+		OnInitialHeaders ServerHeadersFunc
+
+		// Called before the response headers of every polling request
+		// and websocket upgrade request (including the handshake request) are written.
+		// For the handshake request, this is called after OnInitialHeaders.
+		//
+		// This is the equivalent of the `headers` event in original Engine.IO.
+		OnHeaders ServerHeadersFunc
+
+		// Called when a new connection is established, after the NewSocketCallback is called.
+		//
+		// This is the equivalent of the `connection` event in original Engine.IO.
+		OnConnection ServerConnectionFunc
+
+		// Called when a connection is closed.
+		//
+		// This is the equivalent of the `close` event of the socket in original Engine.IO.
+		OnConnectionClose ServerConnectionCloseFunc
+
+		// Called when a client starts upgrading its transport.
+		//
+		// This is the equivalent of the `upgrading` event of the socket in original Engine.IO.
+		OnUpgradeStart ServerUpgradeFunc
+
+		// Called when a client has completed upgrading its transport.
+		//
+		// This is the equivalent of the `upgrade` event of the socket in original Engine.IO.
+		OnUpgrade ServerUpgradeFunc
+
+		// Called when a transport upgrade fails (e.g. UpgradeTimeout is exceeded).
+		OnUpgradeError ServerUpgradeErrorFunc
+
+		// Called when a request is rejected with an Engine.IO error
+		// (such as ErrorUnknownSID, ErrorBadHandshakeMethod or ErrorUnknownTransport).
+		// You may use this function to monitor the clients that keep hitting stale session IDs.
+		//
+		// This is the equivalent of the `connection_error` event in original Engine.IO.
+		OnConnectionError ServerConnectionErrorFunc
+
+		// Custom session ID generator. Session IDs must be URL-safe, since they are sent in the query string.
+		// If the generated session ID is already in use, the generator is called again (up to Base64IDMaxTry times).
+		//
+		// This is the equivalent of overriding `generateId` in original Engine.IO.
+		//
+		// Default: GenerateBase64ID(Base64IDSize)
+		IDGenerator ServerIDGeneratorFunc
+
 		// Callback function for Engine.IO server errors.
 		// You may use this function to log server errors.
 		OnError ErrorCallback
@@ -56,23 +224,57 @@ type (
 	}
 
 	Server struct {
-		authenticator ServerAuthFunc
+		authenticator          ServerAuthFunc
+		authenticatorWithError ServerAuthErrorFunc
 
 		pingInterval   time.Duration
 		pingTimeout    time.Duration
 		upgradeTimeout time.Duration
+		shutdownJitter time.Duration
+
+		transports      []string
+		disableUpgrades bool
 
 		maxBufferSize        int64
+		maxPacketSize        int64
 		disableMaxBufferSize bool
 
+		disableJSONP bool
+		allowEIO3    bool
+
+		// 0 means HTTP compression is disabled.
+		httpCompressionThreshold int
+		httpCompressionLevel     int
+
+		cookie *CookieConfig
+
+		onInitialHeaders ServerHeadersFunc
+		onHeaders        ServerHeadersFunc
+
 		webTransportServer *webtransport.Server
 
 		wsAcceptOptions *websocket.AcceptOptions
 
+		cors *cors
+
+		limiter *connLimiter
+
+		faultInjector *faultInjector
+
 		onSocket NewSocketCallback
 		onError  ErrorCallback
 		store    *socketStore
 
+		onConnection      ServerConnectionFunc
+		onConnectionClose ServerConnectionCloseFunc
+		onUpgradeStart    ServerUpgradeFunc
+		onUpgrade         ServerUpgradeFunc
+		onUpgradeError    ServerUpgradeErrorFunc
+		onConnectionError ServerConnectionErrorFunc
+
+		idGenerator ServerIDGeneratorFunc
+
+		shuttingDown    atomic.Bool
 		closed          chan struct{}
 		closeOnce       sync.Once
 		debug           Debugger
@@ -94,32 +296,80 @@ func newServer(onSocket NewSocketCallback, config *ServerConfig, testWaitUpgrade
 	}
 
 	s := &Server{
-		authenticator: config.Authenticator,
+		authenticator:          config.Authenticator,
+		authenticatorWithError: config.AuthenticatorWithError,
 
 		pingInterval:   config.PingInterval,
 		pingTimeout:    config.PingTimeout,
 		upgradeTimeout: config.UpgradeTimeout,
+		shutdownJitter: config.ShutdownJitter,
+
+		transports:      config.Transports,
+		disableUpgrades: config.DisableUpgrades,
 
 		maxBufferSize:        config.MaxBufferSize,
+		maxPacketSize:        config.MaxPacketSize,
 		disableMaxBufferSize: config.DisableMaxBufferSize,
 
+		disableJSONP: config.DisableJSONP,
+		allowEIO3:    config.AllowEIO3,
+
+		cookie: config.Cookie,
+
+		onInitialHeaders: config.OnInitialHeaders,
+		onHeaders:        config.OnHeaders,
+
 		webTransportServer: config.WebTransportServer,
 
 		wsAcceptOptions: config.WebSocketAcceptOptions,
 
+		limiter: newConnLimiter(config.ConnectionLimits),
+
+		faultInjector: newFaultInjector(config.FaultInjection),
+
 		onSocket: onSocket,
 		onError:  config.OnError,
 
 		store: newSocketStore(),
 
+		onConnection:      config.OnConnection,
+		onConnectionClose: config.OnConnectionClose,
+		onUpgradeStart:    config.OnUpgradeStart,
+		onUpgrade:         config.OnUpgrade,
+		onUpgradeError:    config.OnUpgradeError,
+		onConnectionError: config.OnConnectionError,
+
+		idGenerator: config.IDGenerator,
+
 		closed:          make(chan struct{}),
 		testWaitUpgrade: testWaitUpgrade,
 	}
 
+	if config.PerMessageDeflate != nil {
+		s.wsAcceptOptions = config.PerMessageDeflate.acceptOptions(s.wsAcceptOptions)
+	}
+
+	if config.HTTPCompression != nil {
+		s.httpCompressionThreshold = config.HTTPCompression.threshold()
+		s.httpCompressionLevel = config.HTTPCompression.level()
+	}
+
+	if config.CORS != nil {
+		s.cors = newCORS(config.CORS)
+		s.wsAcceptOptions = s.cors.webSocketAcceptOptions(s.wsAcceptOptions)
+	}
+
 	if s.authenticator == nil {
 		s.authenticator = func(w http.ResponseWriter, r *http.Request) (ok bool) { return true }
 	}
 
+	if s.onInitialHeaders == nil {
+		s.onInitialHeaders = func(headers http.Header, r *http.Request) {}
+	}
+	if s.onHeaders == nil {
+		s.onHeaders = func(headers http.Header, r *http.Request) {}
+	}
+
 	if s.pingInterval == 0 {
 		s.pingInterval = defaultPingInterval
 	}
@@ -132,12 +382,23 @@ func newServer(onSocket NewSocketCallback, config *ServerConfig, testWaitUpgrade
 		s.upgradeTimeout = defaultUpgradeTimeout
 	}
 
+	if len(s.transports) == 0 {
+		s.transports = []string{"polling", "websocket"}
+		if s.webTransportServer != nil {
+			s.transports = append(s.transports, "webtransport")
+		}
+	}
+
 	if s.disableMaxBufferSize {
 		s.maxBufferSize = 0
+		s.maxPacketSize = 0
 	} else {
 		if s.maxBufferSize == 0 {
 			s.maxBufferSize = defaultMaxBufferSize
 		}
+		if s.maxPacketSize == 0 {
+			s.maxPacketSize = s.maxBufferSize
+		}
 	}
 
 	if config.Debugger != nil {
@@ -150,6 +411,29 @@ func newServer(onSocket NewSocketCallback, config *ServerConfig, testWaitUpgrade
 	if s.onError == nil {
 		s.onError = func(err error) {}
 	}
+
+	if s.onConnection == nil {
+		s.onConnection = func(socket ServerSocket, r *http.Request) {}
+	}
+	if s.onConnectionClose == nil {
+		s.onConnectionClose = func(socket ServerSocket, reason Reason, err error) {}
+	}
+	if s.onUpgradeStart == nil {
+		s.onUpgradeStart = func(socket ServerSocket, transportName string, r *http.Request) {}
+	}
+	if s.onUpgrade == nil {
+		s.onUpgrade = func(socket ServerSocket, transportName string, r *http.Request) {}
+	}
+	if s.onUpgradeError == nil {
+		s.onUpgradeError = func(socket ServerSocket, transportName string, r *http.Request, err error) {}
+	}
+	if s.onConnectionError == nil {
+		s.onConnectionError = func(r *http.Request, err *ServerError) {}
+	}
+
+	if s.idGenerator == nil {
+		s.idGenerator = func(r *http.Request) (sid string, err error) { return GenerateBase64ID(Base64IDSize) }
+	}
 	return s
 }
 
@@ -166,7 +450,36 @@ func (s *Server) Run() error {
 	if s.upgradeTimeout < 1*time.Second {
 		return fmt.Errorf("eio: upgradeTimeout must be equal or greater than 1 second")
 	}
-	return nil
+	if s.httpCompressionThreshold > 0 && (s.httpCompressionLevel < flate.HuffmanOnly || s.httpCompressionLevel > flate.BestCompression) {
+		return fmt.Errorf("eio: invalid HTTP compression level: %d", s.httpCompressionLevel)
+	}
+	for _, name := range s.transports {
+		if _, ok := getServerTransport(name); !ok {
+			return fmt.Errorf("eio: invalid transport name: %s", name)
+		}
+		if name == "webtransport" && s.webTransportServer == nil {
+			return fmt.Errorf("eio: webtransport transport requires WebTransportServer to be set")
+		}
+	}
+	return s.limiter.init()
+}
+
+func (s *Server) isTransportAllowed(name string) bool {
+	return slices.Contains(s.transports, name)
+}
+
+// Return the transports that a client using the given transport can upgrade to.
+// The order of the returned transports is the order of the Transports option.
+func (s *Server) upgradesOf(name string) (upgrades []string) {
+	if s.disableUpgrades {
+		return nil
+	}
+	for _, t := range s.transports {
+		if canUpgrade(name, t) {
+			upgrades = append(upgrades, t)
+		}
+	}
+	return
 }
 
 func (s *Server) PollTimeout() time.Duration {
@@ -184,36 +497,69 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
+	shuttingDown := s.shuttingDown.Load()
 
-	q := r.URL.Query()
+	if s.cors != nil {
+		handled := s.cors.handle(w, r)
+		if handled {
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin != "" && isWebSocketUpgrade(r) && !s.cors.isOriginAllowed(origin, r) {
+			s.debug.Log("WebSocket connection from a disallowed origin", origin)
+			s.connectionError(w, r, ErrorForbidden)
+			return
+		}
+	}
+
+	var (
+		q       = r.URL.Query()
+		version = ProtocolVersion
+		err     error
+	)
 
 	// Skip protocol version check for WebTransport
 	if r.ProtoMajor != 3 {
-		version, err := strconv.Atoi(q.Get("EIO"))
+		version, err = strconv.Atoi(q.Get("EIO"))
 		if err != nil {
-			writeServerError(w, ErrorUnsupportedProtocolVersion)
+			s.connectionError(w, r, ErrorUnsupportedProtocolVersion)
 			return
 		}
-		if version != ProtocolVersion {
-			writeServerError(w, ErrorUnsupportedProtocolVersion)
+		if version != ProtocolVersion && (version != ProtocolVersion3 || !s.allowEIO3) {
+			s.connectionError(w, r, ErrorUnsupportedProtocolVersion)
 			return
 		}
 	}
 
 	sid := q.Get("sid")
 	if sid == "" {
-		s.handleHandshake(w, r)
+		if shuttingDown {
+			s.debug.Log("Handshake received while shutting down")
+			// Let the client retry (and reach another server) shortly.
+			w.Header().Set("Retry-After", "1")
+			s.connectionError(w, r, ErrorServerShuttingDown)
+			return
+		}
+		s.handleHandshake(w, r, version)
 	} else {
 		socket, ok := s.store.get(sid)
 		if !ok {
-			writeServerError(w, ErrorUnknownSID)
+			s.connectionError(w, r, ErrorUnknownSID)
 			return
 		}
 
 		t := socket.Transport()
 		n := r.URL.Query().Get("transport")
 
+		s.onHeaders(w.Header(), r)
+
 		if t.Name() != n {
+			if shuttingDown {
+				s.debug.Log("Upgrade received while shutting down")
+				s.connectionError(w, r, ErrorBadRequest)
+				return
+			}
 			s.maybeUpgrade(w, r, socket, n, nil, nil)
 			return
 		}
@@ -222,26 +568,65 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) handleHandshake(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleHandshake(w http.ResponseWriter, r *http.Request, version int) {
 	q := r.URL.Query()
 	n := q.Get("transport")
 	supportsBinary := q.Get("b64") == ""
 
 	if r.Method != "GET" && r.ProtoMajor != 3 {
-		writeServerError(w, ErrorBadHandshakeMethod)
+		s.connectionError(w, r, ErrorBadHandshakeMethod)
 		return
 	} else if r.Method == "CONNECT" && r.ProtoMajor == 3 && n == "" {
 		s.onWebTransport(w, r)
 		return
 	}
 
-	ok := s.authenticator(w, r)
+	if !s.isTransportAllowed(n) {
+		s.debug.Log("Transport is not allowed", n)
+		s.connectionError(w, r, ErrorUnknownTransport)
+		return
+	}
+
+	ip, ok := s.limiter.acquire(r)
 	if !ok {
-		w.WriteHeader(http.StatusForbidden)
+		s.debug.Log("Handshake rejected due to the connection limits", ip)
+		s.limiter.writeServiceUnavailable(w)
 		return
 	}
+	release := true
+	defer func() {
+		if release {
+			s.limiter.release(ip)
+		}
+	}()
 
-	sid, err := s.generateSID()
+	ok = s.authenticator(w, r)
+	if !ok {
+		s.connectionError(w, r, ErrorForbidden)
+		return
+	}
+	if s.authenticatorWithError != nil {
+		err := s.authenticatorWithError(w, r)
+		if err != nil {
+			s.debug.Log("Handshake rejected", err)
+			var se *ServerError
+			if errors.As(err, &se) {
+				if se.StatusCode == 0 {
+					// Report the status that is written, without modifying the returned error.
+					e := *se
+					e.StatusCode = http.StatusForbidden
+					se = &e
+				}
+				s.onConnectionError(r, se)
+				writeServerErrorWithStatus(w, se.StatusCode, se)
+			} else {
+				s.connectionError(w, r, ErrorForbidden)
+			}
+			return
+		}
+	}
+
+	sid, err := s.generateSID(r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		s.onError(err)
@@ -249,29 +634,24 @@ func (s *Server) handleHandshake(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var (
-		t        ServerTransport
-		upgrades []string
+		upgrades = s.upgradesOf(n)
 		c        = transport.NewCallbacks()
 	)
-	switch n {
-	case "polling":
-		t = polling.NewServerTransport(c, s.maxBufferSize, s.PollTimeout())
-		upgrades = []string{"websocket"}
-		if s.webTransportServer != nil {
-			upgrades = append(upgrades, "webtransport")
-		}
-	case "websocket":
-		t = _websocket.NewServerTransport(c, s.maxBufferSize, supportsBinary, s.wsAcceptOptions)
-		if s.webTransportServer != nil {
-			upgrades = []string{"webtransport"}
-		}
-	default:
-		writeServerError(w, ErrorUnknownTransport)
+	t, err := s.newTransport(n, c, version, supportsBinary, r)
+	if err != nil {
+		s.debug.Log("Transport couldn't be created", err)
+		s.connectionError(w, r, ErrorBadRequest)
 		return
 	}
 
 	s.debug.Log("Transport is set to", n)
 
+	if s.cookie != nil {
+		http.SetCookie(w, s.cookie.cookie(sid))
+	}
+	s.onInitialHeaders(w.Header(), r)
+	s.onHeaders(w.Header(), r)
+
 	handshakePacket, err := s.newHandshakePacket(sid, upgrades)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -284,7 +664,9 @@ func (s *Server) handleHandshake(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	socket := s.newSocket(w, sid, upgrades, c, t)
+	// From now on, the connection slot is released when the socket is closed.
+	release = false
+	socket := s.newSocket(w, r, sid, ip, version, upgrades, c, t)
 	if socket == nil {
 		return
 	}
@@ -293,15 +675,18 @@ func (s *Server) handleHandshake(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) onWebTransport(w http.ResponseWriter, r *http.Request) {
-	if s.webTransportServer == nil {
-		writeServerError(w, ErrorUnknownTransport)
+	if s.webTransportServer == nil || !s.isTransportAllowed("webtransport") {
+		s.connectionError(w, r, ErrorUnknownTransport)
 		return
 	}
 
-	var (
-		c = transport.NewCallbacks()
-		t = _webtransport.NewServerTransport(c, s.maxBufferSize, s.webTransportServer)
-	)
+	c := transport.NewCallbacks()
+	t, err := s.newTransport("webtransport", c, ProtocolVersion, true, r)
+	if err != nil {
+		s.debug.Log("Transport couldn't be created", err)
+		s.connectionError(w, r, ErrorBadRequest)
+		return
+	}
 
 	sid, err := t.Handshake(nil, w, r)
 	if err != nil {
@@ -310,15 +695,24 @@ func (s *Server) onWebTransport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if sid == "" {
-		sid, err = s.generateSID()
+		// The response is already written by the handshake. The session is closed if a limit is exceeded.
+		ip, ok := s.limiter.acquire(r)
+		if !ok {
+			s.debug.Log("Handshake rejected due to the connection limits", ip)
+			t.Close()
+			return
+		}
+
+		sid, err = s.generateSID(r)
 		if err != nil {
+			s.limiter.release(ip)
 			w.WriteHeader(http.StatusInternalServerError)
 			s.onError(err)
 			t.Close()
 			return
 		}
 
-		socket := s.newSocket(w, sid, nil, c, t)
+		socket := s.newSocket(w, r, sid, ip, ProtocolVersion, nil, c, t)
 		if socket == nil {
 			t.Close()
 			return
@@ -335,7 +729,7 @@ func (s *Server) onWebTransport(w http.ResponseWriter, r *http.Request) {
 	} else {
 		socket, ok := s.store.get(sid)
 		if !ok {
-			writeServerError(w, ErrorUnknownSID)
+			s.connectionError(w, r, ErrorUnknownSID)
 			t.Close()
 			return
 		}
@@ -351,27 +745,46 @@ func (s *Server) onWebTransport(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) newSocket(
 	w http.ResponseWriter,
+	r *http.Request,
 	sid string,
+	clientIP string,
+	version int,
 	upgrades []string,
 	c *transport.Callbacks,
 	t ServerTransport,
 ) *serverSocket {
-	socket := newServerSocket(sid, upgrades, t, c, s.pingInterval, s.pingTimeout, s.debug, s.store.delete)
-
-	callbacks := s.onSocket(socket)
-	socket.setCallbacks(callbacks)
+	handshake := newHandshake(r, clientIP)
+	socket := newServerSocket(sid, handshake, version, upgrades, t, c, s.pingInterval, s.pingTimeout, s.debug, s.onSocketClose)
 
 	ok := s.store.set(sid, socket)
 	if !ok {
 		w.WriteHeader(http.StatusInternalServerError)
-		err := fmt.Errorf("sid's overlap")
-		s.onError(wrapInternalError(err))
-		socket.close(ReasonTransportError, err)
+		s.onError(wrapInternalError(fmt.Errorf("sid's overlap")))
+		// The socket is not in the store and OnConnection was not called for it,
+		// so don't let it go through onSocketClose.
+		socket.discard()
+		s.limiter.release(clientIP)
 		return nil
 	}
+
+	callbacks := s.onSocket(socket)
+	socket.setCallbacks(callbacks)
+	s.onConnection(socket, r)
 	return socket
 }
 
+func (s *Server) onSocketClose(socket *serverSocket, reason Reason, err error) {
+	s.store.delete(socket.ID())
+	s.limiter.release(socket.handshake.Address)
+	s.onConnectionClose(socket, reason, err)
+}
+
+// Return the number of the current connections and the number of the handshakes
+// rejected due to ConnectionLimits.
+func (s *Server) ConnectionLimitsStats() ConnectionLimitsStats {
+	return s.limiter.stats()
+}
+
 func (s *Server) newHandshakePacket(sid string, upgrades []string) (*parser.Packet, error) {
 	data, err := json.Marshal(&parser.HandshakeResponse{
 		SID:          sid,
@@ -398,9 +811,23 @@ func (s *Server) maybeUpgrade(
 		supportsBinary = q.Get("b64") == ""
 	)
 
+	if !s.isTransportAllowed(upgradeTo) || !slices.Contains(socket.Upgrades(), upgradeTo) {
+		s.debug.Log("Upgrade to", upgradeTo, "is not allowed")
+		if t != nil {
+			t.Close()
+		}
+		if s.isTransportAllowed(upgradeTo) {
+			s.connectionError(w, r, ErrorBadRequest)
+		} else {
+			s.connectionError(w, r, ErrorUnknownTransport)
+		}
+		return
+	}
+
 	if c == nil {
 		c = transport.NewCallbacks()
 	}
+	s.onUpgradeStart(socket, upgradeTo, r)
 
 	done := make(chan struct{})
 	once := new(sync.Once)
@@ -425,9 +852,12 @@ func (s *Server) maybeUpgrade(
 		case parser.PacketTypeUpgrade:
 			once.Do(func() { close(done) })
 			socket.upgradeTo(t, c)
+			s.onUpgrade(socket, upgradeTo, r)
 		default:
 			t.Close()
-			socket.onError(wrapInternalError(fmt.Errorf("upgrade failed: invalid packet received: packet type: %d", packet.Type)))
+			err := wrapInternalError(fmt.Errorf("upgrade failed: invalid packet received: packet type: %d", packet.Type))
+			socket.onError(err)
+			s.onUpgradeError(socket, upgradeTo, r, err)
 			return
 		}
 	}
@@ -440,28 +870,26 @@ func (s *Server) maybeUpgrade(
 		}, nil)
 	}
 
-	switch upgradeTo {
-	case "websocket":
-		t = _websocket.NewServerTransport(c, s.maxBufferSize, supportsBinary, s.wsAcceptOptions)
-		_, err := t.Handshake(nil, w, r)
+	// The transport is not nil if it was already created and handshaked (see onWebTransport).
+	if t == nil {
+		var err error
+		t, err = s.newTransport(upgradeTo, c, socket.ProtocolVersion(), supportsBinary, r)
+		if err != nil {
+			s.debug.Log("Transport couldn't be created", err)
+			s.connectionError(w, r, ErrorBadRequest)
+			s.onUpgradeError(socket, upgradeTo, r, err)
+			return
+		}
+		_, err = t.Handshake(nil, w, r)
 		if err != nil {
 			s.debug.Log("Handshake error", err)
 			t.Close()
+			s.onUpgradeError(socket, upgradeTo, r, err)
 			return
 		}
 		if s.testWaitUpgrade {
 			time.Sleep(1001 * time.Millisecond)
 		}
-	case "webtransport":
-		if t == nil {
-			s.debug.Log("t == nil. This shouldn't have happened")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	default:
-		s.debug.Log("Invalid upgradeTo", upgradeTo)
-		writeServerError(w, ErrorBadRequest)
-		return
 	}
 
 	if s.testWaitUpgrade {
@@ -478,7 +906,9 @@ func (s *Server) maybeUpgrade(
 			s.debug.Log("`done` triggered")
 		case <-time.After(s.upgradeTimeout):
 			t.Close()
-			socket.onError(fmt.Errorf("eio: upgrade failed: %w", errUpgradeTimeoutExceeded))
+			err := fmt.Errorf("eio: upgrade failed: %w", errUpgradeTimeoutExceeded)
+			socket.onError(err)
+			s.onUpgradeError(socket, upgradeTo, r, err)
 		}
 	}()
 
@@ -494,6 +924,48 @@ func (s *Server) IsClosed() bool {
 	}
 }
 
+// Gracefully shut down the server. Server cannot be restarted once it is shut down.
+//
+// New handshakes and upgrades are rejected. A CLOSE packet is sent to every socket,
+// and the socket is closed once the packet is delivered (a polling client has to poll for it).
+// If ShutdownJitter is set, each socket is shut down after a random delay within that window.
+//
+// If ctx is done before all sockets are closed, the remaining sockets are closed immediately and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.ShutdownWithHook(ctx, nil)
+}
+
+// Same as Shutdown, except that beforeClose is called for each socket before its CLOSE packet is sent
+// (after the random delay of ShutdownJitter). This is used by the protocols on top of Engine.IO
+// (such as Socket.IO) to finish their work on a socket before it is closed.
+func (s *Server) ShutdownWithHook(ctx context.Context, beforeClose func(ctx context.Context, socket ServerSocket)) error {
+	s.debug.Log("Shutting down")
+	s.shuttingDown.Store(true)
+
+	var wg sync.WaitGroup
+	for _, socket := range s.store.getAll() {
+		wg.Add(1)
+		go func(socket *serverSocket) {
+			defer wg.Done()
+			if s.shutdownJitter > 0 {
+				select {
+				case <-time.After(time.Duration(rand.Int63n(int64(s.shutdownJitter)))):
+				case <-ctx.Done():
+				}
+			}
+			if beforeClose != nil {
+				beforeClose(ctx, socket)
+			}
+			socket.shutdown(ctx)
+		}(socket)
+	}
+	wg.Wait()
+
+	err := ctx.Err()
+	s.Close()
+	return err
+}
+
 func (s *Server) Close() error {
 	s.debug.Log("Closing")
 
@@ -2,12 +2,37 @@ package eio
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/tomruk/socket.io-go/engine.io/transport"
 )
 
+// An Engine.IO error that is sent by the server when a request is rejected.
+//
+// This can be returned from ServerAuthErrorFunc to reject the handshake with a custom error.
+// On the client side, Dial returns a *ServerError if the server rejects the handshake.
 type ServerError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+
+	// Optional additional information about the error.
+	// This must be JSON serializable.
+	//
+	// On the client side, this is decoded from JSON (e.g. into a map[string]any).
+	Context any `json:"context,omitempty"`
+
+	// HTTP status code of the response. This is not a part of the JSON encoded error.
+	//
+	// On the server side, the handshake is rejected with this status code
+	// (default: 403 for the errors returned from ServerAuthErrorFunc).
+	// On the client side, this is set to the status code of the response.
+	StatusCode int `json:"-"`
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("eio: server error: %s (code: %d)", e.Message, e.Code)
 }
 
 func GetServerError(code int) (se ServerError, ok bool) {
@@ -22,41 +47,90 @@ const (
 	ErrorBadRequest
 	ErrorForbidden
 	ErrorUnsupportedProtocolVersion
+
+	// The handshake is rejected because the server is shutting down (see: Server.Shutdown).
+	// This is not a part of the original Engine.IO.
+	ErrorServerShuttingDown
 )
 
 var serverErrors = map[int]ServerError{
 	ErrorUnknownTransport: {
-		Code:    0,
-		Message: "Transport unknown",
+		Code:       0,
+		Message:    "Transport unknown",
+		StatusCode: http.StatusBadRequest,
 	},
 	ErrorUnknownSID: {
-		Code:    1,
-		Message: "Session ID unknown",
+		Code:       1,
+		Message:    "Session ID unknown",
+		StatusCode: http.StatusBadRequest,
 	},
 	ErrorBadHandshakeMethod: {
-		Code:    2,
-		Message: "Bad handshake method",
+		Code:       2,
+		Message:    "Bad handshake method",
+		StatusCode: http.StatusBadRequest,
 	},
 	ErrorBadRequest: {
-		Code:    3,
-		Message: "Bad request",
+		Code:       3,
+		Message:    "Bad request",
+		StatusCode: http.StatusBadRequest,
 	},
 	ErrorForbidden: {
-		Code:    4,
-		Message: "Forbidden",
+		Code:       4,
+		Message:    "Forbidden",
+		StatusCode: http.StatusForbidden,
 	},
 	ErrorUnsupportedProtocolVersion: {
-		Code:    5,
-		Message: "Unsupported protocol version",
+		Code:       5,
+		Message:    "Unsupported protocol version",
+		StatusCode: http.StatusBadRequest,
+	},
+	ErrorServerShuttingDown: {
+		Code:       6,
+		Message:    "Server is shutting down",
+		StatusCode: http.StatusServiceUnavailable,
 	},
 }
 
 func writeServerError(w http.ResponseWriter, code int) {
-	w.WriteHeader(http.StatusBadRequest)
-
-	em, ok := serverErrors[code]
+	se, ok := serverErrors[code]
 	if ok {
-		data, _ := json.Marshal(&em)
-		w.Write(data)
+		writeServerErrorWithStatus(w, se.StatusCode, &se)
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Report the error with OnConnectionError, and write it to the client.
+func (s *Server) connectionError(w http.ResponseWriter, r *http.Request, code int) {
+	if se, ok := GetServerError(code); ok {
+		s.onConnectionError(r, &se)
+	}
+	writeServerError(w, code)
+}
+
+func writeServerErrorWithStatus(w http.ResponseWriter, status int, se *ServerError) {
+	data, err := json.Marshal(se)
+	if err != nil {
+		// Context is not serializable. Send the error without it.
+		data, _ = json.Marshal(&ServerError{Code: se.Code, Message: se.Message})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// Convert the handshake error returned from a client transport into a *ServerError
+// if the server responded with an Engine.IO error. Otherwise err is returned as it is.
+func serverErrorFromHandshake(err error) error {
+	var httpErr *transport.HTTPError
+	if !errors.As(err, &httpErr) {
+		return err
+	}
+
+	se := new(ServerError)
+	if json.Unmarshal(httpErr.Body, se) != nil || se.Message == "" {
+		return err
 	}
+	se.StatusCode = httpErr.StatusCode
+	return se
 }
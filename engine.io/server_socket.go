@@ -1,6 +1,7 @@
 package eio
 
 import (
+	"context"
 	"sync/atomic"
 	"time"
 
@@ -11,19 +12,24 @@ import (
 )
 
 type serverSocket struct {
-	id           string
-	upgrades     []string
-	pingInterval time.Duration
-	pingTimeout  time.Duration
+	id              string
+	protocolVersion int
+	upgrades        []string
+	pingInterval    time.Duration
+	pingTimeout     time.Duration
+
+	handshake *Handshake
 
 	transport   ServerTransport
 	transportMu sync.RWMutex
 
 	callbacks atomic.Value
+	stats     *socketStats
 
+	// In the protocol v3, this is signalled on every packet received.
 	pongChan chan struct{}
 
-	onClose   func(sid string)
+	onClose   func(socket *serverSocket, reason Reason, err error)
 	closeChan chan struct{}
 	closeOnce sync.Once
 
@@ -32,26 +38,31 @@ type serverSocket struct {
 
 func newServerSocket(
 	id string,
+	handshake *Handshake,
+	protocolVersion int,
 	upgrades []string,
 	transport ServerTransport,
 	callbacks *transport.Callbacks,
 	pingInterval time.Duration,
 	pingTimeout time.Duration,
 	debug Debugger,
-	onClose func(sid string),
+	onClose func(socket *serverSocket, reason Reason, err error),
 ) *serverSocket {
 	// The function below might be nil for testing purposes. See: sstore_test.go
 	if onClose == nil {
-		onClose = func(sid string) {}
+		onClose = func(socket *serverSocket, reason Reason, err error) {}
 	}
 
 	s := &serverSocket{
-		id:           id,
-		upgrades:     upgrades,
-		pingInterval: pingInterval,
-		pingTimeout:  pingTimeout,
+		id:              id,
+		protocolVersion: protocolVersion,
+		handshake:       handshake,
+		upgrades:        upgrades,
+		pingInterval:    pingInterval,
+		pingTimeout:     pingTimeout,
 
 		transport: transport,
+		stats:     newSocketStats(),
 
 		pongChan: make(chan struct{}, 1),
 
@@ -62,7 +73,12 @@ func newServerSocket(
 
 	s.setCallbacks(nil)
 	callbacks.Set(s.onPacket, s.onTransportClose)
-	go s.pingPong(pingInterval, pingTimeout)
+	callbacks.SetOnSent(s.stats.onSend)
+	if protocolVersion == ProtocolVersion3 {
+		go s.waitForPings(pingInterval, pingTimeout)
+	} else {
+		go s.pingPong(pingInterval, pingTimeout)
+	}
 	return s
 }
 
@@ -96,8 +112,14 @@ func (s *serverSocket) TransportName() string {
 	return s.transport.Name()
 }
 
+func (s *serverSocket) ProtocolVersion() int { return s.protocolVersion }
+
+func (s *serverSocket) Handshake() *Handshake { return s.handshake }
+
 func (s *serverSocket) Upgrades() []string { return s.upgrades }
 
+func (s *serverSocket) Stats() SocketStats { return s.stats.get(s.TransportName()) }
+
 func (s *serverSocket) PingInterval() time.Duration { return s.pingInterval }
 
 func (s *serverSocket) PingTimeout() time.Duration { return s.pingTimeout }
@@ -106,6 +128,7 @@ func (s *serverSocket) upgradeTo(t ServerTransport, c *transport.Callbacks) {
 	s.debug.Log("UpgradeTo", t.Name())
 
 	c.Set(s.onPacket, s.onTransportClose)
+	c.SetOnSent(s.stats.onSend)
 
 	s.transportMu.Lock()
 	defer s.transportMu.Unlock()
@@ -113,6 +136,7 @@ func (s *serverSocket) upgradeTo(t ServerTransport, c *transport.Callbacks) {
 	old := s.transport
 	s.transport = t
 	old.Discard()
+	s.stats.onUpgrade()
 
 	// Get the queued packets from the old transport and send them with the new one.
 	qp := old.QueuedPackets()
@@ -139,11 +163,13 @@ func (s *serverSocket) pingPong(pingInterval time.Duration, pingTimeout time.Dur
 			s.onError(err)
 			return
 		}
+		sentAt := time.Now()
 		s.Send(ping)
 
 		select {
 		case <-s.pongChan:
 			s.debug.Log("pingPong", "pong received")
+			s.stats.setRTT(time.Since(sentAt))
 		case <-time.After(pingTimeout):
 			s.debug.Log("pingPong", "pingTimeout exceeded")
 			s.close(ReasonPingTimeout, nil)
@@ -155,7 +181,25 @@ func (s *serverSocket) pingPong(pingInterval time.Duration, pingTimeout time.Dur
 	}
 }
 
+// In the protocol v3, the client sends the pings and the server replies with pongs.
+// Any packet received is considered a sign of liveness.
+func (s *serverSocket) waitForPings(pingInterval time.Duration, pingTimeout time.Duration) {
+	for {
+		select {
+		case <-s.pongChan:
+		case <-time.After(pingInterval + pingTimeout):
+			s.debug.Log("waitForPings", "pingTimeout exceeded")
+			s.close(ReasonPingTimeout, nil)
+			return
+		case <-s.closeChan:
+			s.debug.Log("waitForPings", "`closeChan` was closed")
+			return
+		}
+	}
+}
+
 func (s *serverSocket) onPacket(packets ...*parser.Packet) {
+	s.stats.onReceive(packets...)
 	s.getCallbacks().OnPacket(packets...)
 	for _, packet := range packets {
 		s.handlePacket(packet)
@@ -163,7 +207,20 @@ func (s *serverSocket) onPacket(packets ...*parser.Packet) {
 }
 
 func (s *serverSocket) handlePacket(packet *parser.Packet) {
+	if s.protocolVersion == ProtocolVersion3 {
+		s.onPong()
+	}
+
 	switch packet.Type {
+	case parser.PacketTypePing:
+		if s.protocolVersion == ProtocolVersion3 {
+			pong, err := parser.NewPacket(parser.PacketTypePong, false, packet.Data)
+			if err != nil {
+				s.onError(err)
+				return
+			}
+			s.Send(pong)
+		}
 	case parser.PacketTypePong:
 		s.onPong()
 	case parser.PacketTypeClose:
@@ -224,7 +281,7 @@ func (s *serverSocket) close(reason Reason, err error) {
 	s.closeOnce.Do(func() {
 		s.debug.Log("Going to close the socket. It is not already closed. Reason", reason)
 		close(s.closeChan)
-		defer s.onClose(s.id)
+		defer s.onClose(s, reason, err)
 
 		defer s.getCallbacks().OnClose(reason, err)
 
@@ -239,3 +296,25 @@ func (s *serverSocket) close(reason Reason, err error) {
 }
 
 func (s *serverSocket) Close() { s.close(ReasonForcedClose, nil) }
+
+// Close the socket and its transport without calling the close callbacks.
+func (s *serverSocket) discard() {
+	s.closeOnce.Do(func() {
+		s.debug.Log("Discarding the socket")
+		close(s.closeChan)
+
+		s.transportMu.RLock()
+		defer s.transportMu.RUnlock()
+		s.transport.Close()
+	})
+}
+
+// Send a CLOSE packet and wait for it to be delivered (or ctx to be done). Then close the socket.
+func (s *serverSocket) shutdown(ctx context.Context) {
+	p, err := parser.NewPacket(parser.PacketTypeClose, false, nil)
+	if err == nil {
+		s.Send(p)
+		s.Transport().WaitForDrain(ctx)
+	}
+	s.close(ReasonServerShuttingDown, nil)
+}
@@ -2,18 +2,27 @@ package eio
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tomruk/socket.io-go/engine.io/parser"
+	"github.com/tomruk/socket.io-go/engine.io/transport"
 )
 
 func TestServer(t *testing.T) {
@@ -129,6 +138,194 @@ func TestServer(t *testing.T) {
 		require.Equal(t, serverErrors[ErrorUnknownTransport].Message, e.Message)
 	})
 
+	t.Run("should fail with a transport that is not in `Transports`", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{Transports: []string{"websocket"}}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q := req.URL.Query()
+		q.Add("EIO", strconv.Itoa(ProtocolVersion))
+		q.Add("transport", "polling")
+		req.URL.RawQuery = q.Encode()
+		io.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		e := new(ServerError)
+		err = json.Unmarshal(rec.Body.Bytes(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		require.Equal(t, serverErrors[ErrorUnknownTransport].Code, e.Code)
+		require.Equal(t, serverErrors[ErrorUnknownTransport].Message, e.Message)
+
+		s := httptest.NewServer(io)
+		socket := testDial(t, s.URL, nil, &ClientConfig{Transports: []string{"websocket"}}, nil)
+		require.Equal(t, "websocket", socket.TransportName())
+		require.Empty(t, socket.Upgrades())
+	})
+
+	t.Run("`Run` should fail with an invalid transport in `Transports`", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{Transports: []string{"polling", "labalubadabaluba"}}, nil)
+		err := io.Run()
+		require.Error(t, err)
+
+		io = newTestServer(nil, &ServerConfig{Transports: []string{"webtransport"}}, nil)
+		err = io.Run()
+		require.Error(t, err, "webtransport shouldn't be allowed without `WebTransportServer`")
+	})
+
+	t.Run("should not advertise upgrades if `DisableUpgrades` is set", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{DisableUpgrades: true}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		socket := testDial(t, s.URL, nil, &ClientConfig{Transports: []string{"polling", "websocket"}}, nil)
+		require.Empty(t, socket.Upgrades())
+		require.Equal(t, "polling", socket.TransportName())
+	})
+
+	t.Run("should use `IDGenerator` and retry if the generated SID is in use", func(t *testing.T) {
+		ids := []string{"node1-a", "node1-a", "node1-b"}
+		io := newTestServer(nil, &ServerConfig{
+			IDGenerator: func(r *http.Request) (sid string, err error) {
+				assert.Equal(t, strconv.Itoa(ProtocolVersion), r.URL.Query().Get("EIO"))
+				sid, ids = ids[0], ids[1:]
+				return
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		socket := testDial(t, s.URL, nil, &ClientConfig{Transports: []string{"polling"}}, nil)
+		require.Equal(t, "node1-a", socket.ID())
+		socket = testDial(t, s.URL, nil, &ClientConfig{Transports: []string{"polling"}}, nil)
+		require.Equal(t, "node1-b", socket.ID())
+		require.Empty(t, ids)
+	})
+
+	t.Run("should discard the new socket if its SID is in use", func(t *testing.T) {
+		var (
+			connections      atomic.Int32
+			connectionCloses atomic.Int32
+		)
+		io := newTestServer(nil, &ServerConfig{
+			OnConnection: func(socket ServerSocket, r *http.Request) { connections.Add(1) },
+			OnConnectionClose: func(socket ServerSocket, reason Reason, err error) {
+				connectionCloses.Add(1)
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		socket := testDial(t, s.URL, nil, &ClientConfig{Transports: []string{"polling"}}, nil)
+		existing, ok := io.store.get(socket.ID())
+		require.True(t, ok)
+
+		r := httptest.NewRequest("GET", "/", nil)
+		ip, ok := io.limiter.acquire(r)
+		require.True(t, ok)
+		rec := httptest.NewRecorder()
+		overlapping := io.newSocket(rec, r, socket.ID(), ip, ProtocolVersion, nil, transport.NewCallbacks(), newTestServerTransport())
+		require.Nil(t, overlapping)
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		current, ok := io.store.get(socket.ID())
+		require.True(t, ok)
+		require.Same(t, existing, current, "the existing socket should stay in the store")
+		require.Equal(t, int32(1), connections.Load())
+		require.Equal(t, int32(0), connectionCloses.Load())
+		require.Equal(t, 1, io.ConnectionLimitsStats().Connections)
+	})
+
+	t.Run("should fail the handshake if `IDGenerator` returns an error", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			IDGenerator: func(r *http.Request) (sid string, err error) {
+				return "", fmt.Errorf("no ID for you")
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := req.URL.Query()
+		q.Add("EIO", strconv.Itoa(ProtocolVersion))
+		q.Add("transport", "polling")
+		req.URL.RawQuery = q.Encode()
+
+		io.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("should use the transports registered with `RegisterServerTransport`", func(t *testing.T) {
+		created := make(chan *ServerTransportOptions, 1)
+		RegisterServerTransport("fake", func(options *ServerTransportOptions) (ServerTransport, error) {
+			created <- options
+			return newTestServerTransport(), nil
+		}, "polling")
+		defer func() {
+			serverTransportsMu.Lock()
+			defer serverTransportsMu.Unlock()
+			delete(serverTransports, "fake")
+		}()
+
+		io := newTestServer(nil, &ServerConfig{Transports: []string{"polling", "fake", "websocket"}}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		require.Equal(t, []string{"fake", "websocket"}, io.upgradesOf("polling"))
+		require.Empty(t, io.upgradesOf("fake"))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/?EIO=4&transport=fake&b64=1", nil)
+		io.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		options := <-created
+		require.Equal(t, ProtocolVersion, options.ProtocolVersion)
+		require.False(t, options.SupportsBinary)
+		require.Equal(t, req, options.Request)
+		require.Len(t, io.store.getAll(), 1)
+
+		io = newTestServer(nil, &ServerConfig{Transports: []string{"polling", "unregistered"}}, nil)
+		require.Error(t, io.Run())
+	})
+
+	t.Run("upgrades should be in the order of `Transports`", func(t *testing.T) {
+		io := newTestServer(nil, nil, nil)
+		io.transports = []string{"webtransport", "polling", "websocket"}
+		require.Equal(t, []string{"webtransport", "websocket"}, io.upgradesOf("polling"))
+		require.Equal(t, []string{"webtransport"}, io.upgradesOf("websocket"))
+		require.Empty(t, io.upgradesOf("webtransport"))
+
+		io.transports = []string{"polling", "websocket"}
+		require.Equal(t, []string{"websocket"}, io.upgradesOf("polling"))
+		require.Empty(t, io.upgradesOf("websocket"))
+	})
+
 	t.Run("should fail with unknown SID", func(t *testing.T) {
 		io := newTestServer(nil, nil, nil)
 		err := io.Run()
@@ -194,8 +391,13 @@ func TestServer(t *testing.T) {
 			return false
 		}
 
+		tw := NewTestWaiter(1)
 		io := newTestServer(nil, &ServerConfig{
 			Authenticator: authenticator,
+			OnConnectionError: func(r *http.Request, err *ServerError) {
+				defer tw.Done()
+				assert.Equal(t, http.StatusForbidden, err.StatusCode)
+			},
 		}, nil)
 		err := io.Run()
 		if err != nil {
@@ -214,6 +416,15 @@ func TestServer(t *testing.T) {
 		req.URL.RawQuery = q.Encode()
 		io.ServeHTTP(rec, req)
 		require.Equal(t, http.StatusForbidden, rec.Code)
+
+		e := new(ServerError)
+		err = json.Unmarshal(rec.Body.Bytes(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		require.Equal(t, serverErrors[ErrorForbidden].Code, e.Code)
+		require.Equal(t, serverErrors[ErrorForbidden].Message, e.Message)
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
 	})
 
 	t.Run("should call `OnClose` with transport error when buffer size is exceeded (polling)", func(t *testing.T) {
@@ -262,6 +473,146 @@ func TestServer(t *testing.T) {
 		tw.WaitTimeout(t, DefaultTestWaitTimeout)
 	})
 
+	t.Run("should reject a chunked request that exceeds the buffer size (polling)", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnClose: func(reason Reason, err error) {
+					defer tw.Done()
+					assert.Equal(t, ReasonTransportError, reason)
+					assert.Error(t, err)
+				},
+			}
+		}, &ServerConfig{
+			MaxBufferSize: 5,
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports: []string{"polling"},
+		}, nil)
+		defer socket.Close()
+
+		q := url.Values{}
+		q.Set("EIO", strconv.Itoa(ProtocolVersion))
+		q.Set("transport", "polling")
+		q.Set("sid", socket.ID())
+		// Hide the length of the body, so that the request is sent without Content-Length.
+		body := iotest.OneByteReader(strings.NewReader("4a\x1e4b\x1e4c\x1e4d"))
+		resp, err := http.Post(s.URL+"/?"+q.Encode(), "text/plain;charset=UTF-8", body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("should reject a chunked Engine.IO v3 request that exceeds the buffer size (polling)", func(t *testing.T) {
+		newRequest := func(method string, sid string, body io.Reader) *http.Request {
+			req, err := http.NewRequest(method, "/", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := req.URL.Query()
+			q.Add("EIO", strconv.Itoa(ProtocolVersion3))
+			q.Add("transport", "polling")
+			if sid != "" {
+				q.Add("sid", sid)
+			}
+			req.URL.RawQuery = q.Encode()
+			return req
+		}
+
+		tw := NewTestWaiter(1)
+		server := newTestServer(func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnClose: func(reason Reason, err error) {
+					defer tw.Done()
+					assert.Equal(t, ReasonTransportError, reason)
+					assert.Error(t, err)
+				},
+			}
+		}, &ServerConfig{
+			AllowEIO3:     true,
+			MaxBufferSize: 5,
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, newRequest("GET", "", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		packets, err := parser.DecodePayloadsV3(rec.Body, false)
+		require.NoError(t, err)
+		hr, err := parser.ParseHandshakeResponse(packets[0])
+		require.NoError(t, err)
+
+		req := newRequest("POST", hr.SID, strings.NewReader("6:4hello6:4hello"))
+		// The length of the body is unknown, as if the request was chunked.
+		req.ContentLength = -1
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("should reject a packet that exceeds `MaxPacketSize` (polling)", func(t *testing.T) {
+		tw := NewTestWaiter(2)
+
+		io := newTestServer(func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnPacket: func(packets ...*parser.Packet) {
+					for _, packet := range packets {
+						if packet.Type == parser.PacketTypeMessage {
+							// The packets before the large one are still received.
+							assert.Equal(t, "a", string(packet.Data))
+							tw.Done()
+						}
+					}
+				},
+				OnClose: func(reason Reason, err error) {
+					defer tw.Done()
+					assert.Equal(t, ReasonTransportError, reason)
+					assert.Error(t, err)
+				},
+			}
+		}, &ServerConfig{
+			MaxBufferSize: 100,
+			MaxPacketSize: 5,
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+		defer s.Close()
+
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports: []string{"polling"},
+		}, nil)
+		defer socket.Close()
+
+		q := url.Values{}
+		q.Set("EIO", strconv.Itoa(ProtocolVersion))
+		q.Set("transport", "polling")
+		q.Set("sid", socket.ID())
+		resp, err := http.Post(s.URL+"/?"+q.Encode(), "text/plain;charset=UTF-8", strings.NewReader("4a\x1e4abcdefgh"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
 	t.Run("`DisableMaxBufferSize` should cause `MaxBufferSize` to be ignored (polling)", func(t *testing.T) {
 		tw := NewTestWaiter(1) // Wait for the server.
 		testData := []byte("12345678")
@@ -567,56 +918,665 @@ func TestServer(t *testing.T) {
 		tw.WaitTimeout(t, DefaultTestWaitTimeout)
 	})
 
-	t.Run("server `Close` method should close sockets", func(t *testing.T) {
-		tw := NewTestWaiter(0)
-		utw := NewTestWaiter(0) // For upgrades.
+	t.Run("CORS should reply to preflight requests", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			CORS: &CORSConfig{
+				AllowedOrigins:   []string{"https://example.com"},
+				AllowCredentials: true,
+				AllowedHeaders:   []string{"Authorization"},
+				MaxAge:           10 * time.Minute,
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
 
-		onSocket := func(socket ServerSocket) *Callbacks {
-			return &Callbacks{
-				OnClose: func(reason Reason, err error) {
-					defer tw.Done()
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("OPTIONS", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "https://example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		io.ServeHTTP(rec, req)
 
-					if reason != ReasonForcedClose {
-						t.Errorf("server: expected reason: %s, but got: %s", ReasonForcedClose, reason)
-					}
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		require.Equal(t, "https://example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+		require.Equal(t, "Authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+		require.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
 
-					if err != nil {
-						t.Errorf("server: err should be nil. Error: %v", err)
-					}
-				},
-			}
-		}
+		// Disallowed origin
+		rec = httptest.NewRecorder()
+		req.Header.Set("Origin", "https://evil.example.com")
+		io.ServeHTTP(rec, req)
 
-		io := newTestServer(onSocket, nil, nil)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, "", rec.Header().Get("Access-Control-Allow-Origin"))
+	})
 
+	t.Run("CORS headers should be set on polling responses", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			CORS: &CORSConfig{
+				AllowOriginFunc: func(origin string, r *http.Request) (ok bool) {
+					return strings.HasSuffix(origin, ".example.com")
+				},
+			},
+		}, nil)
 		err := io.Run()
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		s := httptest.NewServer(io)
-
-		transportsToTest := [][]string{
-			{"polling"},
-			{"websocket"},
-			{"polling", "websocket"},
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
 		}
+		req.Header.Set("Origin", "https://app.example.com")
 
-		for _, transports := range transportsToTest {
-			tw.Add(2) // For server and client.
+		q := req.URL.Query()
+		q.Add("EIO", strconv.Itoa(ProtocolVersion))
+		q.Add("transport", "polling")
+		req.URL.RawQuery = q.Encode()
+		io.ServeHTTP(rec, req)
 
-			callbacks := &Callbacks{
-				OnClose: func(reason Reason, err error) {
-					defer tw.Done()
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	})
 
-					if reason != ReasonTransportClose {
-						t.Errorf("client: expected reason: %s, but got: %s", ReasonTransportClose, reason)
-					}
+	t.Run("CORS should reject WebSocket connections from disallowed origins", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			CORS: &CORSConfig{
+				AllowedOrigins: []string{"https://example.com"},
+			},
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
 
-					if err != nil {
-						t.Errorf("client: err should be nil. Error: %v", err)
-					}
-				},
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "https://evil.example.com")
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+
+		q := req.URL.Query()
+		q.Add("EIO", strconv.Itoa(ProtocolVersion))
+		q.Add("transport", "websocket")
+		req.URL.RawQuery = q.Encode()
+		io.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, []string{"example.com"}, io.wsAcceptOptions.OriginPatterns)
+	})
+
+	t.Run("JSONP should fail if `DisableJSONP` is set", func(t *testing.T) {
+		io := newTestServer(nil, &ServerConfig{
+			DisableJSONP: true,
+		}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q := req.URL.Query()
+		q.Add("EIO", strconv.Itoa(ProtocolVersion))
+		q.Add("transport", "polling")
+		q.Add("j", "0")
+		req.URL.RawQuery = q.Encode()
+
+		io.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Equal(t, 0, len(io.store.getAll()))
+	})
+
+	t.Run("JSONP should fail with an invalid index", func(t *testing.T) {
+		io := newTestServer(nil, nil, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q := req.URL.Query()
+		q.Add("EIO", strconv.Itoa(ProtocolVersion))
+		q.Add("transport", "polling")
+		q.Add("j", "0);alert(1")
+		req.URL.RawQuery = q.Encode()
+
+		io.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.NotContains(t, rec.Body.String(), "alert")
+	})
+
+	t.Run("polling responses should be compressed if `HTTPCompression` is set", func(t *testing.T) {
+		server := newTestServer(nil, &ServerConfig{HTTPCompression: &HTTPCompressionConfig{Threshold: 1}}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handshake := func(acceptEncoding string) *http.Response {
+			rec := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", acceptEncoding)
+			}
+
+			q := req.URL.Query()
+			q.Add("EIO", strconv.Itoa(ProtocolVersion))
+			q.Add("transport", "polling")
+			req.URL.RawQuery = q.Encode()
+
+			server.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusOK, rec.Code)
+			return rec.Result()
+		}
+
+		resp := handshake("gzip, deflate")
+		require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		require.Contains(t, resp.Header.Values("Vary"), "Accept-Encoding")
+		r, err := gzip.NewReader(resp.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(body), "0{"))
+
+		resp = handshake("deflate")
+		require.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+		zr, err := zlib.NewReader(resp.Body)
+		require.NoError(t, err)
+		body, err = io.ReadAll(zr)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(body), "0{"))
+
+		resp = handshake("")
+		require.Equal(t, "", resp.Header.Get("Content-Encoding"))
+		body, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(body), "0{"))
+	})
+
+	t.Run("should fail to run if the HTTP compression level is invalid", func(t *testing.T) {
+		server := newTestServer(nil, &ServerConfig{HTTPCompression: &HTTPCompressionConfig{Level: 10}}, nil)
+		err := server.Run()
+		require.Error(t, err)
+	})
+
+	t.Run("should set a cookie on handshake if `Cookie` is set", func(t *testing.T) {
+		server := newTestServer(nil, &ServerConfig{
+			Cookie: &CookieConfig{
+				Name:   "sticky",
+				Secure: true,
+				MaxAge: time.Hour,
+			},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q := req.URL.Query()
+		q.Add("EIO", strconv.Itoa(ProtocolVersion))
+		q.Add("transport", "polling")
+		req.URL.RawQuery = q.Encode()
+
+		server.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		resp := rec.Result()
+		cookies := resp.Cookies()
+		require.Equal(t, 1, len(cookies))
+		cookie := cookies[0]
+
+		packets, err := parser.DecodePayloads(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(packets))
+		hr, err := parser.ParseHandshakeResponse(packets[0])
+		require.NoError(t, err)
+
+		require.Equal(t, "sticky", cookie.Name)
+		require.Equal(t, hr.SID, cookie.Value)
+		require.Equal(t, "/", cookie.Path)
+		require.True(t, cookie.HttpOnly)
+		require.True(t, cookie.Secure)
+		require.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+		require.Equal(t, 3600, cookie.MaxAge)
+
+		require.False(t, (&CookieConfig{DisableHttpOnly: true}).cookie(hr.SID).HttpOnly)
+	})
+
+	t.Run("`OnInitialHeaders` and `OnHeaders` should be called", func(t *testing.T) {
+		server := newTestServer(nil, &ServerConfig{
+			OnInitialHeaders: func(headers http.Header, r *http.Request) {
+				headers.Set("X-Initial", "1")
+			},
+			OnHeaders: func(headers http.Header, r *http.Request) {
+				headers.Set("X-Transport", r.URL.Query().Get("transport"))
+			},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newRequest := func(method, sid string, body io.Reader) *http.Request {
+			req, err := http.NewRequest(method, "/", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := req.URL.Query()
+			q.Add("EIO", strconv.Itoa(ProtocolVersion))
+			q.Add("transport", "polling")
+			if sid != "" {
+				q.Add("sid", sid)
+			}
+			req.URL.RawQuery = q.Encode()
+			return req
+		}
+
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, newRequest("GET", "", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "1", rec.Header().Get("X-Initial"))
+		require.Equal(t, "polling", rec.Header().Get("X-Transport"))
+
+		packets, err := parser.DecodePayloads(rec.Body)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(packets))
+		hr, err := parser.ParseHandshakeResponse(packets[0])
+		require.NoError(t, err)
+
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, newRequest("POST", hr.SID, strings.NewReader("4hello")))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "", rec.Header().Get("X-Initial"))
+		require.Equal(t, "polling", rec.Header().Get("X-Transport"))
+	})
+
+	t.Run("`OnConnectionError` should be called when a request is rejected", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+		server := newTestServer(nil, &ServerConfig{
+			OnConnectionError: func(r *http.Request, err *ServerError) {
+				defer tw.Done()
+				assert.Equal(t, "stale", r.URL.Query().Get("sid"))
+				assert.Equal(t, serverErrors[ErrorUnknownSID].Code, err.Code)
+				assert.Equal(t, serverErrors[ErrorUnknownSID].Message, err.Message)
+				// The status code of the response.
+				assert.Equal(t, http.StatusBadRequest, err.StatusCode)
+			},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := req.URL.Query()
+		q.Add("EIO", strconv.Itoa(ProtocolVersion))
+		q.Add("transport", "polling")
+		q.Add("sid", "stale")
+		req.URL.RawQuery = q.Encode()
+
+		server.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("should reply 503 with `Retry-After` if `MaxConnections` is exceeded", func(t *testing.T) {
+		server := newTestServer(nil, &ServerConfig{
+			ConnectionLimits: &ConnectionLimitsConfig{
+				MaxConnections: 1,
+				RetryAfter:     1500 * time.Millisecond,
+			},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+
+		handshake := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/?EIO=4&transport=polling", nil)
+			server.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := handshake()
+		require.Equal(t, http.StatusOK, rec.Code)
+		rec = handshake()
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+		stats := server.ConnectionLimitsStats()
+		require.Equal(t, 1, stats.Connections)
+		require.Equal(t, uint64(1), stats.RejectedMaxConnections)
+
+		// The connection slot should be released when the socket is closed.
+		for _, socket := range server.store.getAll() {
+			socket.Close()
+		}
+		require.Equal(t, 0, server.ConnectionLimitsStats().Connections)
+
+		rec = handshake()
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("`MaxConnectionsPerIP` should use X-Forwarded-For only if the request is from a trusted proxy", func(t *testing.T) {
+		server := newTestServer(nil, &ServerConfig{
+			ConnectionLimits: &ConnectionLimitsConfig{
+				MaxConnectionsPerIP: 1,
+				TrustedProxies:      []string{"10.0.0.0/8", "192.168.1.1"},
+			},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+
+		handshake := func(remoteAddr string, forwardedFor string) int {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/?EIO=4&transport=polling", nil)
+			req.RemoteAddr = remoteAddr
+			if forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", forwardedFor)
+			}
+			server.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		require.Equal(t, http.StatusOK, handshake("10.0.0.1:1234", "203.0.113.1"))
+		// The same client through another chain of trusted proxies.
+		require.Equal(t, http.StatusServiceUnavailable, handshake("192.168.1.1:1234", "203.0.113.1, 10.0.0.3"))
+		require.Equal(t, http.StatusOK, handshake("10.0.0.1:1234", "203.0.113.2"))
+
+		// X-Forwarded-For of an untrusted peer should be ignored.
+		require.Equal(t, http.StatusOK, handshake("192.0.2.1:1234", "203.0.113.3"))
+		require.Equal(t, http.StatusServiceUnavailable, handshake("192.0.2.1:1234", "203.0.113.4"))
+
+		stats := server.ConnectionLimitsStats()
+		require.Equal(t, 3, stats.Connections)
+		require.Equal(t, uint64(2), stats.RejectedMaxConnectionsPerIP)
+
+		server = newTestServer(nil, &ServerConfig{
+			ConnectionLimits: &ConnectionLimitsConfig{TrustedProxies: []string{"10.0.0.0/abc"}},
+		}, nil)
+		err = server.Run()
+		require.Error(t, err)
+	})
+
+	t.Run("should reply 503 if `IsOverloaded` returns true", func(t *testing.T) {
+		var overloaded atomic.Bool
+		overloaded.Store(true)
+		server := newTestServer(nil, &ServerConfig{
+			ConnectionLimits: &ConnectionLimitsConfig{
+				IsOverloaded: func(r *http.Request) bool { return overloaded.Load() },
+			},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+
+		handshake := func() *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/?EIO=4&transport=polling", nil)
+			server.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := handshake()
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.Equal(t, "5", rec.Header().Get("Retry-After"))
+		require.Equal(t, uint64(1), server.ConnectionLimitsStats().RejectedOverloaded)
+
+		overloaded.Store(false)
+		rec = handshake()
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("`ServerSocket.Handshake` should contain the details of the handshake request", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+		onSocket := func(socket ServerSocket) *Callbacks {
+			defer tw.Done()
+			handshake := socket.Handshake()
+			assert.Equal(t, "203.0.113.1", handshake.Address)
+			assert.Equal(t, "10.0.0.1:1234", handshake.RemoteAddr)
+			assert.Equal(t, "bar", handshake.Query.Get("foo"))
+			assert.Equal(t, "/?EIO=4&transport=polling&foo=bar", handshake.URL)
+			assert.Equal(t, "Bearer abc", handshake.Headers.Get("Authorization"))
+			assert.True(t, handshake.XDomain)
+			assert.False(t, handshake.Secure)
+			assert.Nil(t, handshake.TLS)
+			assert.WithinDuration(t, time.Now(), handshake.Issued, DefaultTestWaitTimeout)
+
+			cookie, err := handshake.Cookie("token")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "xyz", cookie.Value)
+			}
+			_, err = handshake.Cookie("nonexistent")
+			assert.ErrorIs(t, err, http.ErrNoCookie)
+			return nil
+		}
+
+		server := newTestServer(onSocket, &ServerConfig{
+			ConnectionLimits: &ConnectionLimitsConfig{TrustedProxies: []string{"10.0.0.1"}},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/?EIO=4&transport=polling&foo=bar", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		req.Header.Set("Origin", "http://example.com")
+		req.Header.Set("Authorization", "Bearer abc")
+		req.Header.Set("Cookie", "token=xyz")
+		server.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("lifecycle callbacks should be called", func(t *testing.T) {
+		tw := NewTestWaiterString()
+		tw.Add("connection")
+		tw.Add("upgradeStart")
+		tw.Add("upgrade")
+		tw.Add("close")
+
+		server := newTestServer(nil, &ServerConfig{
+			OnConnection: func(socket ServerSocket, r *http.Request) {
+				assert.Equal(t, "polling", r.URL.Query().Get("transport"))
+				tw.Done("connection")
+			},
+			OnUpgradeStart: func(socket ServerSocket, transportName string, r *http.Request) {
+				assert.Equal(t, "websocket", transportName)
+				assert.Equal(t, socket.ID(), r.URL.Query().Get("sid"))
+				tw.Done("upgradeStart")
+			},
+			OnUpgrade: func(socket ServerSocket, transportName string, r *http.Request) {
+				assert.Equal(t, "websocket", transportName)
+				assert.Equal(t, "websocket", socket.TransportName())
+				tw.Done("upgrade")
+			},
+			OnUpgradeError: func(socket ServerSocket, transportName string, r *http.Request, err error) {
+				t.Errorf("upgrade error: %s", err)
+			},
+			OnConnectionClose: func(socket ServerSocket, reason Reason, err error) {
+				assert.Equal(t, ReasonTransportClose, reason)
+				tw.Done("close")
+			},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(server)
+
+		upgraded := NewTestWaiter(1)
+		socket := testDial(t, s.URL, nil, &ClientConfig{
+			Transports:  []string{"polling", "websocket"},
+			UpgradeDone: func(transportName string) { upgraded.Done() },
+		}, nil)
+		upgraded.WaitTimeout(t, DefaultTestWaitTimeout)
+		socket.Close()
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("should accept Engine.IO v3 clients only if `AllowEIO3` is set", func(t *testing.T) {
+		newRequest := func(method string, sid string, body io.Reader) *http.Request {
+			req, err := http.NewRequest(method, "/", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := req.URL.Query()
+			q.Add("EIO", strconv.Itoa(ProtocolVersion3))
+			q.Add("transport", "polling")
+			if sid != "" {
+				q.Add("sid", sid)
+			}
+			req.URL.RawQuery = q.Encode()
+			return req
+		}
+
+		server := newTestServer(nil, nil, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, newRequest("GET", "", nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		tw := NewTestWaiter(1)
+		onSocket := func(socket ServerSocket) *Callbacks {
+			assert.Equal(t, ProtocolVersion3, socket.ProtocolVersion())
+			return &Callbacks{
+				OnPacket: func(packets ...*parser.Packet) {
+					for _, packet := range packets {
+						if packet.Type == parser.PacketTypeMessage {
+							assert.Equal(t, "hello", string(packet.Data))
+							tw.Done()
+						}
+					}
+				},
+			}
+		}
+		server = newTestServer(onSocket, &ServerConfig{AllowEIO3: true}, nil)
+		err = server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, newRequest("GET", "", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		packets, err := parser.DecodePayloadsV3(rec.Body, false)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(packets))
+		hr, err := parser.ParseHandshakeResponse(packets[0])
+		require.NoError(t, err)
+
+		// In the protocol v3, the client sends the pings.
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, newRequest("POST", hr.SID, strings.NewReader("6:2probe6:4hello")))
+		require.Equal(t, http.StatusOK, rec.Code)
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, newRequest("GET", hr.SID, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "6:3probe", rec.Body.String())
+	})
+
+	t.Run("server `Close` method should close sockets", func(t *testing.T) {
+		tw := NewTestWaiter(0)
+		utw := NewTestWaiter(0) // For upgrades.
+
+		onSocket := func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnClose: func(reason Reason, err error) {
+					defer tw.Done()
+
+					if reason != ReasonForcedClose {
+						t.Errorf("server: expected reason: %s, but got: %s", ReasonForcedClose, reason)
+					}
+
+					if err != nil {
+						t.Errorf("server: err should be nil. Error: %v", err)
+					}
+				},
+			}
+		}
+
+		io := newTestServer(onSocket, nil, nil)
+
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := httptest.NewServer(io)
+
+		transportsToTest := [][]string{
+			{"polling"},
+			{"websocket"},
+			{"polling", "websocket"},
+		}
+
+		for _, transports := range transportsToTest {
+			tw.Add(2) // For server and client.
+
+			callbacks := &Callbacks{
+				OnClose: func(reason Reason, err error) {
+					defer tw.Done()
+
+					if reason != ReasonTransportClose {
+						t.Errorf("client: expected reason: %s, but got: %s", ReasonTransportClose, reason)
+					}
+
+					if err != nil {
+						t.Errorf("client: err should be nil. Error: %v", err)
+					}
+				},
 			}
 
 			if len(transports) > 1 {
@@ -656,6 +1616,141 @@ func TestServer(t *testing.T) {
 
 		tw.WaitTimeout(t, DefaultTestWaitTimeout)
 	})
+
+	t.Run("server `Shutdown` method should send CLOSE and close sockets", func(t *testing.T) {
+		tw := NewTestWaiter(0)
+		utw := NewTestWaiter(0) // For upgrades.
+
+		onSocket := func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnClose: func(reason Reason, err error) {
+					defer tw.Done()
+					assert.Equal(t, ReasonServerShuttingDown, reason, "server")
+					assert.NoError(t, err, "server")
+				},
+			}
+		}
+
+		io := newTestServer(onSocket, &ServerConfig{ShutdownJitter: 50 * time.Millisecond}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+
+		transportsToTest := [][]string{
+			{"polling"},
+			{"websocket"},
+			{"polling", "websocket"},
+		}
+
+		for _, transports := range transportsToTest {
+			tw.Add(2) // For server and client.
+
+			callbacks := &Callbacks{
+				OnClose: func(reason Reason, err error) {
+					defer tw.Done()
+					// The client should close the connection itself after receiving the CLOSE packet.
+					assert.Equal(t, ReasonTransportClose, reason, "client")
+					assert.NoError(t, err, "client")
+				},
+			}
+
+			if len(transports) > 1 {
+				utw.Add(1)
+			}
+
+			upgradeDone := func(transportName string) {
+				utw.Done()
+			}
+
+			testDial(t, s.URL, callbacks, &ClientConfig{Transports: transports, UpgradeDone: upgradeDone}, nil)
+		}
+
+		// Wait for upgrades to finish.
+		timedout := utw.WaitTimeout(t, 10*time.Second)
+		if timedout {
+			t.Fatal("upgrades couldn't finish")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTestWaitTimeout)
+		defer cancel()
+		err = io.Shutdown(ctx)
+		require.NoError(t, err)
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+
+		resp, err := s.Client().Get(s.URL + "?EIO=4&transport=polling")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "server should have been shut down")
+	})
+
+	t.Run("should reject handshakes with `ErrorServerShuttingDown` while shutting down", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+		server := newTestServer(nil, &ServerConfig{
+			ShutdownJitter: time.Hour,
+			OnConnectionError: func(r *http.Request, err *ServerError) {
+				defer tw.Done()
+				assert.Equal(t, 6, err.Code)
+			},
+		}, nil)
+		err := server.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(server)
+		defer s.Close()
+		// Keep a socket connected, so that the shutdown is in progress until ctx is done.
+		testDial(t, s.URL, nil, &ClientConfig{Transports: []string{"websocket"}}, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTestWaitTimeout)
+		defer cancel()
+		go server.Shutdown(ctx)
+		time.Sleep(50 * time.Millisecond)
+
+		resp, err := s.Client().Get(s.URL + "?EIO=4&transport=polling")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, "1", resp.Header.Get("Retry-After"))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"code":6,"message":"Server is shutting down"}`, string(body))
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
+
+	t.Run("server `Shutdown` method should return the error of the context", func(t *testing.T) {
+		tw := NewTestWaiter(1)
+
+		onSocket := func(socket ServerSocket) *Callbacks {
+			return &Callbacks{
+				OnClose: func(reason Reason, err error) {
+					defer tw.Done()
+					assert.Equal(t, ReasonServerShuttingDown, reason)
+				},
+			}
+		}
+
+		io := newTestServer(onSocket, &ServerConfig{ShutdownJitter: time.Hour}, nil)
+		err := io.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewServer(io)
+		testDial(t, s.URL, nil, &ClientConfig{Transports: []string{"websocket"}}, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err = io.Shutdown(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.True(t, io.IsClosed())
+
+		tw.WaitTimeout(t, DefaultTestWaitTimeout)
+	})
 }
 
 type testServerOptions struct {
@@ -19,11 +19,21 @@ type (
 
 		Send(packets ...*parser.Packet)
 
+		// Transport statistics of the socket.
+		Stats() SocketStats
+
 		Close()
 	}
 
 	ServerSocket interface {
 		Socket
+
+		// Engine.IO protocol version of the client.
+		// This is ProtocolVersion3 for the Socket.IO v2 clients (see ServerConfig.AllowEIO3), and ProtocolVersion otherwise.
+		ProtocolVersion() int
+
+		// Information about the request that established the connection (the handshake request).
+		Handshake() *Handshake
 	}
 
 	ClientSocket interface {
@@ -0,0 +1,104 @@
+package eio
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/tomruk/socket.io-go/engine.io/parser"
+)
+
+// Transport statistics of a socket. See Socket.Stats.
+type SocketStats struct {
+	// Name of the current transport.
+	TransportName string
+
+	// Number of the transport upgrades done (e.g. 1 after polling is upgraded to websocket).
+	Upgrades int
+
+	// Total length of the encoded packets sent and received.
+	// This doesn't include the transport overhead (HTTP headers, WebSocket framing, base64 encoding etc.).
+	BytesSent     uint64
+	BytesReceived uint64
+
+	// Number of the Engine.IO packets sent and received (including the pings and pongs).
+	// The packets are counted when the transport writes them to the connection, so the packets
+	// dropped or duplicated by the fault injection (see: FaultInjectionConfig) are counted accordingly.
+	PacketsSent     uint64
+	PacketsReceived uint64
+
+	// Round-trip time of the last ping/pong. This is 0 if no round-trip has been measured yet.
+	//
+	// On the server side, this is measured with the pings sent by the server
+	// (not available for the Engine.IO v3 clients, since they send the pings).
+	// On the client side, this is estimated from the time between two pings sent by the server
+	// (see: socketStats.onPing), so it is available after the second ping.
+	RTT time.Duration
+
+	// Time elapsed since the handshake.
+	Age time.Duration
+}
+
+type socketStats struct {
+	createdAt time.Time
+
+	upgrades        atomic.Int64
+	bytesSent       atomic.Uint64
+	bytesReceived   atomic.Uint64
+	packetsSent     atomic.Uint64
+	packetsReceived atomic.Uint64
+	rtt             atomic.Int64
+
+	// Unix time (in nanoseconds) of the last ping received. Only used on the client side.
+	lastPingAt atomic.Int64
+}
+
+func newSocketStats() *socketStats {
+	return &socketStats{createdAt: time.Now()}
+}
+
+func (s *socketStats) onSend(packets ...*parser.Packet) {
+	s.packetsSent.Add(uint64(len(packets)))
+	s.bytesSent.Add(encodedLen(packets))
+}
+
+func (s *socketStats) onReceive(packets ...*parser.Packet) {
+	s.packetsReceived.Add(uint64(len(packets)))
+	s.bytesReceived.Add(encodedLen(packets))
+}
+
+func (s *socketStats) onUpgrade() { s.upgrades.Add(1) }
+
+func (s *socketStats) setRTT(rtt time.Duration) { s.rtt.Store(int64(rtt)) }
+
+// The server sends a ping pingInterval after it receives the pong of the previous ping,
+// so the time between two pings is pingInterval plus a round-trip.
+func (s *socketStats) onPing(pingInterval time.Duration) {
+	now := time.Now().UnixNano()
+	last := s.lastPingAt.Swap(now)
+	if last == 0 {
+		return
+	}
+	if rtt := time.Duration(now-last) - pingInterval; rtt > 0 {
+		s.setRTT(rtt)
+	}
+}
+
+func (s *socketStats) get(transportName string) SocketStats {
+	return SocketStats{
+		TransportName:   transportName,
+		Upgrades:        int(s.upgrades.Load()),
+		BytesSent:       s.bytesSent.Load(),
+		BytesReceived:   s.bytesReceived.Load(),
+		PacketsSent:     s.packetsSent.Load(),
+		PacketsReceived: s.packetsReceived.Load(),
+		RTT:             time.Duration(s.rtt.Load()),
+		Age:             time.Since(s.createdAt),
+	}
+}
+
+func encodedLen(packets []*parser.Packet) (n uint64) {
+	for _, packet := range packets {
+		n += uint64(packet.EncodedLen(true))
+	}
+	return
+}
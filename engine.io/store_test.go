@@ -16,7 +16,7 @@ func TestSocketStore(t *testing.T) {
 	count := 0
 	countMu := new(sync.Mutex)
 
-	onClose := func(sid string) {
+	onClose := func(socket *serverSocket, reason Reason, err error) {
 		countMu.Lock()
 		count++
 		countMu.Unlock()
@@ -26,7 +26,7 @@ func TestSocketStore(t *testing.T) {
 		sid := strconv.Itoa(i)
 		ft := newTestServerTransport()
 		c := ft.callbacks
-		socket := newServerSocket(sid, nil, ft, c, 0, 0, NewNoopDebugger(), onClose)
+		socket := newServerSocket(sid, new(Handshake), ProtocolVersion, nil, ft, c, 0, 0, NewNoopDebugger(), onClose)
 
 		ok := store.set(socket.ID(), socket)
 		require.True(t, ok)
@@ -1,6 +1,7 @@
 package eio
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/tomruk/socket.io-go/engine.io/parser"
@@ -30,6 +31,12 @@ type (
 		// Return the packets that are waiting on the pollQueue (polling only).
 		QueuedPackets() []*parser.Packet
 
+		// Wait until the packets that are waiting on the pollQueue are retrieved by the client,
+		// or until ctx is done (polling only). Transports without a queue should return immediately.
+		//
+		// Return value of drained is false if ctx is done before the queue is drained.
+		WaitForDrain(ctx context.Context) (drained bool)
+
 		// If you run this method in a transport (see the close method of polling for example), call it on a new goroutine.
 		// Otherwise it can call the close function recursively.
 		Send(packets ...*parser.Packet)
@@ -56,7 +63,10 @@ type (
 		// If sid is set, you're upgrading to this transport. Expect an OPEN packet. (see websocket/client.go for example)
 		//
 		// onPacket callback must not be called in this method.
-		Handshake() (hr *parser.HandshakeResponse, err error)
+		//
+		// ctx bounds the handshake. The connection must not be closed when ctx is done after the handshake.
+		// See transport.HandshakeContext.
+		Handshake(ctx context.Context) (hr *parser.HandshakeResponse, err error)
 
 		// This method will be called right after the handshake is done and it will only called once, on a new goroutine.
 		// Use this method to start the connection loop.
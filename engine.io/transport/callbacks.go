@@ -14,11 +14,13 @@ type (
 type Callbacks struct {
 	onPacket atomic.Value
 	onClose  atomic.Value
+	onSent   atomic.Value
 }
 
 func NewCallbacks() *Callbacks {
 	c := new(Callbacks)
 	c.Set(nil, nil)
+	c.SetOnSent(nil)
 	return c
 }
 
@@ -32,6 +34,22 @@ func (c *Callbacks) OnClose(transportName string, err error) {
 	f(transportName, err)
 }
 
+// Transports call this after the packets are written to the connection
+// (for the polling transport, when the packets are written to a poll response).
+func (c *Callbacks) OnSent(packet ...*parser.Packet) {
+	f := c.onSent.Load().(PacketCallback)
+	f(packet...)
+}
+
+func (c *Callbacks) SetOnSent(onSent PacketCallback) {
+	if onSent != nil {
+		c.onSent.Store(onSent)
+	} else {
+		var f PacketCallback = func(packet ...*parser.Packet) {}
+		c.onSent.Store(f)
+	}
+}
+
 func (c *Callbacks) Set(onPacket PacketCallback, onClose CloseCallback) {
 	if onPacket != nil {
 		c.onPacket.Store(onPacket)
@@ -10,10 +10,12 @@ import (
 func TestCallbacks(t *testing.T) {
 	callbacks := Callbacks{}
 	callbacks.Set(nil, nil)
+	callbacks.SetOnSent(nil)
 
 	v := reflect.ValueOf(callbacks)
-	require.Equal(t, 2, v.NumField(), "number of fields must be 2, if not, that means another field is added. add that field to the test and increase the number")
+	require.Equal(t, 3, v.NumField(), "number of fields must be 3, if not, that means another field is added. add that field to the test and increase the number")
 
 	require.NotNil(t, callbacks.onPacket.Load())
 	require.NotNil(t, callbacks.onClose.Load())
+	require.NotNil(t, callbacks.onSent.Load())
 }
@@ -0,0 +1,13 @@
+package transport
+
+import "context"
+
+// Return a context for a handshake that creates a long-lived connection (e.g. a websocket connection).
+//
+// The returned context is canceled when ctx is done, until stop is called.
+// Call stop after the handshake, so that the connection isn't closed when ctx is done later on.
+func HandshakeContext(ctx context.Context) (handshakeCtx context.Context, stop func()) {
+	handshakeCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopAfter := context.AfterFunc(ctx, cancel)
+	return handshakeCtx, func() { stopAfter() }
+}
@@ -0,0 +1,16 @@
+package transport
+
+import "fmt"
+
+// Returned by the client transports when the server responds with an unexpected HTTP status code.
+type HTTPError struct {
+	StatusCode int
+
+	// Beginning of the response body. Engine.IO servers send
+	// the error in JSON (e.g. {"code":3,"message":"Bad request"}).
+	Body []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("transport: non-200 HTTP response received. response code: %d", e.StatusCode)
+}
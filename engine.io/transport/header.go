@@ -2,6 +2,7 @@ package transport
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/tomruk/socket.io-go/internal/sync"
 )
@@ -41,3 +42,63 @@ func (r *RequestHeader) Del(key string) {
 	defer r.mu.Unlock()
 	r.header.Del(key)
 }
+
+type (
+	// Return the HTTP headers to add to a request of a client transport.
+	RequestHeaderFunc func() (http.Header, error)
+
+	// Return the query parameters to add to a request of a client transport.
+	QueryFunc func() (url.Values, error)
+)
+
+// Headers and query parameters of the requests made by a client transport.
+type RequestOptions struct {
+	// Headers to add to every request. Can be nil.
+	Header *RequestHeader
+
+	// Called before every request (handshakes and polls).
+	// The returned headers replace the ones in Header with the same keys. Can be nil.
+	HeaderFunc RequestHeaderFunc
+
+	// Called before every request (handshakes and polls).
+	// The returned parameters replace the ones in the URL with the same keys. Can be nil.
+	QueryFunc QueryFunc
+}
+
+// Return the headers to add to a request.
+func (o *RequestOptions) BuildHeader() (http.Header, error) {
+	h := make(http.Header)
+	if o == nil {
+		return h, nil
+	}
+	if o.Header != nil {
+		for k, v := range o.Header.Header() {
+			h[k] = v
+		}
+	}
+	if o.HeaderFunc != nil {
+		extra, err := o.HeaderFunc()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range extra {
+			h[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	return h, nil
+}
+
+// Add the query parameters returned by QueryFunc to q.
+func (o *RequestOptions) BuildQuery(q url.Values) error {
+	if o == nil || o.QueryFunc == nil {
+		return nil
+	}
+	extra, err := o.QueryFunc()
+	if err != nil {
+		return err
+	}
+	for k, v := range extra {
+		q[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/tomruk/socket.io-go/internal/sync"
+
+	"github.com/tomruk/socket.io-go/engine.io/parser"
+	"github.com/tomruk/socket.io-go/engine.io/transport"
+)
+
+type ClientTransport struct {
+	sid             string
+	protocolVersion int
+	url             *url.URL
+
+	requestOptions *transport.RequestOptions
+
+	conn *conn
+
+	callbacks *transport.Callbacks
+	once      sync.Once
+}
+
+func NewClientTransport(
+	callbacks *transport.Callbacks,
+	sid string,
+	protocolVersion int,
+	url url.URL,
+	requestOptions *transport.RequestOptions,
+) *ClientTransport {
+	return &ClientTransport{
+		sid:             sid,
+		protocolVersion: protocolVersion,
+		url:             &url,
+		requestOptions:  requestOptions,
+		callbacks:       callbacks,
+	}
+}
+
+func (t *ClientTransport) Name() string { return "memory" }
+
+func (t *ClientTransport) Handshake(ctx context.Context) (hr *parser.HandshakeResponse, err error) {
+	if t.sid != "" {
+		return nil, fmt.Errorf("memory: upgrading to the memory transport is not supported")
+	}
+
+	handler, ok := getHandler(t.url.Host)
+	if !ok {
+		return nil, fmt.Errorf("memory: no server is registered with the name: %s", t.url.Host)
+	}
+
+	client, server := newPipe()
+	t.conn = client
+
+	r, err := t.newRequest(server)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		w    = newResponseRecorder()
+		done = make(chan struct{})
+	)
+	// If the handshake is successful, ServeHTTP returns when the connection is closed.
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(w, r)
+	}()
+
+	var packets []*parser.Packet
+	select {
+	case <-ctx.Done():
+		// ServeHTTP returns after the connection is closed.
+		client.close()
+		return nil, ctx.Err()
+	case packets = <-client.in:
+	case <-done:
+		select {
+		case packets = <-client.in:
+		default:
+			// The handshake was rejected.
+			client.close()
+			statusCode, body := w.result()
+			return nil, &transport.HTTPError{StatusCode: statusCode, Body: body}
+		}
+	}
+
+	if len(packets) < 1 {
+		client.close()
+		return nil, fmt.Errorf("memory: expected at least 1 packet")
+	}
+	hr, err = parser.ParseHandshakeResponse(packets[0])
+	if err != nil {
+		client.close()
+		return nil, err
+	}
+	t.sid = hr.SID
+	return hr, nil
+}
+
+func (t *ClientTransport) newRequest(server *conn) (*http.Request, error) {
+	u := *t.url
+	q := u.Query()
+	err := t.requestOptions.BuildQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	q.Set("EIO", strconv.Itoa(t.protocolVersion))
+	q.Set("transport", t.Name())
+	u.RawQuery = q.Encode()
+
+	ctx := context.WithValue(context.Background(), connContextKey{}, server)
+	r, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.RemoteAddr = Scheme
+	r.Header, err = t.requestOptions.BuildHeader()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (t *ClientTransport) Run() {
+	for {
+		packets, err := t.conn.receive()
+		if err != nil {
+			t.close(nil)
+			return
+		}
+		t.callbacks.OnPacket(packets...)
+	}
+}
+
+func (t *ClientTransport) Send(packets ...*parser.Packet) {
+	err := t.conn.send(packets...)
+	if err != nil {
+		t.close(nil)
+		return
+	}
+	t.callbacks.OnSent(packets...)
+}
+
+func (t *ClientTransport) Discard() {
+	t.once.Do(func() {
+		if t.conn != nil {
+			t.conn.close()
+		}
+	})
+}
+
+func (t *ClientTransport) close(err error) {
+	t.once.Do(func() {
+		defer t.callbacks.OnClose(t.Name(), err)
+		if t.conn != nil {
+			t.conn.close()
+		}
+	})
+}
+
+func (t *ClientTransport) Close() {
+	t.close(nil)
+}
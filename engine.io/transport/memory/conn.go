@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/tomruk/socket.io-go/internal/sync"
+
+	"github.com/tomruk/socket.io-go/engine.io/parser"
+)
+
+// Number of the packet batches that can be sent without the other end receiving them.
+const bufferSize = 256
+
+var errClosed = fmt.Errorf("memory: connection is closed")
+
+// One end of an in-memory connection.
+type conn struct {
+	in  chan []*parser.Packet
+	out chan []*parser.Packet
+
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+func newPipe() (client, server *conn) {
+	var (
+		closed    = make(chan struct{})
+		closeOnce = new(sync.Once)
+		a         = make(chan []*parser.Packet, bufferSize)
+		b         = make(chan []*parser.Packet, bufferSize)
+	)
+	client = &conn{in: a, out: b, closed: closed, closeOnce: closeOnce}
+	server = &conn{in: b, out: a, closed: closed, closeOnce: closeOnce}
+	return
+}
+
+// The packets are copied, so that the sender can reuse them (and their buffers).
+func (c *conn) send(packets ...*parser.Packet) error {
+	copied := make([]*parser.Packet, len(packets))
+	for i, packet := range packets {
+		p := *packet
+		p.Data = bytes.Clone(packet.Data)
+		copied[i] = &p
+	}
+
+	select {
+	case <-c.closed:
+		return errClosed
+	default:
+	}
+
+	select {
+	case c.out <- copied:
+		return nil
+	case <-c.closed:
+		return errClosed
+	}
+}
+
+// The packets sent before the connection is closed are received before errClosed is returned.
+func (c *conn) receive() ([]*parser.Packet, error) {
+	select {
+	case packets := <-c.in:
+		return packets, nil
+	case <-c.closed:
+		select {
+		case packets := <-c.in:
+			return packets, nil
+		default:
+			return nil, errClosed
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+// A minimal http.ResponseWriter to capture the response of a rejected handshake.
+type responseRecorder struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+	mu         sync.Mutex
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header:     make(http.Header),
+		statusCode: http.StatusOK,
+	}
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.body.Write(p)
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statusCode = statusCode
+}
+
+func (r *responseRecorder) result() (statusCode int, body []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statusCode, bytes.Clone(r.body.Bytes())
+}
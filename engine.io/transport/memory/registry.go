@@ -0,0 +1,46 @@
+// Package memory implements an in-memory transport that connects a client and a server
+// in the same process, without HTTP or network sockets.
+//
+// Register the server (an eio.Server, a sio.Server or any http.Handler that passes the
+// requests to an eio.Server) with a name, and connect to it with the URL memory://name
+//
+// The memory transport is opt-in: the server must have "memory" in its Transports option.
+package memory
+
+import (
+	"net/http"
+
+	"github.com/tomruk/socket.io-go/internal/sync"
+)
+
+// URL scheme of the memory transport.
+const Scheme = "memory"
+
+var (
+	handlers   = make(map[string]http.Handler)
+	handlersMu sync.RWMutex
+)
+
+// Make the handler reachable at the URL memory://name
+//
+// If a handler with the same name is already registered, it is replaced.
+func Register(name string, handler http.Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[name] = handler
+}
+
+// Remove the handler with the given name.
+// Existing connections are not closed.
+func Unregister(name string) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	delete(handlers, name)
+}
+
+func getHandler(name string) (handler http.Handler, ok bool) {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	handler, ok = handlers[name]
+	return
+}
@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/tomruk/socket.io-go/internal/sync"
+
+	"github.com/tomruk/socket.io-go/engine.io/parser"
+	"github.com/tomruk/socket.io-go/engine.io/transport"
+)
+
+type connContextKey struct{}
+
+var errMaxBufferSizeExceeded = fmt.Errorf("memory: maximum buffer size exceeded")
+
+type ServerTransport struct {
+	readLimit int64
+
+	conn *conn
+
+	callbacks *transport.Callbacks
+	once      sync.Once
+}
+
+// r is the handshake request. It must be made by a memory client transport.
+func NewServerTransport(
+	callbacks *transport.Callbacks,
+	maxBufferSize int64,
+	r *http.Request,
+) (*ServerTransport, error) {
+	conn, ok := r.Context().Value(connContextKey{}).(*conn)
+	if !ok {
+		return nil, fmt.Errorf("memory: the request was not made by a memory client")
+	}
+	return &ServerTransport{
+		readLimit: maxBufferSize,
+		conn:      conn,
+		callbacks: callbacks,
+	}, nil
+}
+
+func (t *ServerTransport) Name() string { return "memory" }
+
+func (t *ServerTransport) QueuedPackets() []*parser.Packet {
+	// There's no queue. Packets are directly sent.
+	return nil
+}
+
+func (t *ServerTransport) WaitForDrain(_ context.Context) (drained bool) {
+	// There's no queue. Packets are directly sent.
+	return true
+}
+
+func (t *ServerTransport) Send(packets ...*parser.Packet) {
+	err := t.conn.send(packets...)
+	if err != nil {
+		t.close(nil)
+		return
+	}
+	t.callbacks.OnSent(packets...)
+}
+
+func (t *ServerTransport) Handshake(handshakePacket *parser.Packet, w http.ResponseWriter, r *http.Request) (sid string, err error) {
+	if handshakePacket != nil {
+		err = t.conn.send(handshakePacket)
+		if err != nil {
+			t.close(err)
+		}
+	}
+	// sid is only for webtransport
+	return "", err
+}
+
+func (t *ServerTransport) PostHandshake(_ *parser.Packet) {
+	for {
+		packets, err := t.conn.receive()
+		if err != nil {
+			t.close(nil)
+			return
+		}
+		if t.readLimit > 0 {
+			for _, packet := range packets {
+				if int64(len(packet.Data)) > t.readLimit {
+					t.close(errMaxBufferSizeExceeded)
+					return
+				}
+			}
+		}
+		t.callbacks.OnPacket(packets...)
+	}
+}
+
+func (t *ServerTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+func (t *ServerTransport) Discard() {
+	t.once.Do(func() {
+		t.conn.close()
+	})
+}
+
+func (t *ServerTransport) close(err error) {
+	t.once.Do(func() {
+		defer t.callbacks.OnClose(t.Name(), err)
+		t.conn.close()
+	})
+}
+
+func (t *ServerTransport) Close() {
+	t.close(nil)
+}
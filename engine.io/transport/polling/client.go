@@ -2,6 +2,8 @@ package polling
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,14 +17,18 @@ import (
 	"github.com/tomruk/socket.io-go/engine.io/transport"
 )
 
+// Maximum number of bytes to read from the body of an error response.
+const maxErrorBodySize = 1024
+
 type ClientTransport struct {
 	sid             string
 	protocolVersion int
 	url             *url.URL
 	initialPacket   *parser.Packet
+	maxBufferSize   int64
 
-	requestHeader *transport.RequestHeader
-	httpClient    *http.Client
+	requestOptions *transport.RequestOptions
+	httpClient     *http.Client
 
 	callbacks *transport.Callbacks
 	pollExit  chan any
@@ -33,13 +39,15 @@ func NewClientTransport(
 	callbacks *transport.Callbacks,
 	protocolVersion int,
 	url url.URL,
-	requestHeader *transport.RequestHeader,
+	requestOptions *transport.RequestOptions,
 	httpClient *http.Client,
+	maxBufferSize int64,
 ) *ClientTransport {
 	return &ClientTransport{
 		protocolVersion: protocolVersion,
+		maxBufferSize:   maxBufferSize,
 		url:             &url,
-		requestHeader:   requestHeader,
+		requestOptions:  requestOptions,
 		httpClient:      httpClient,
 		callbacks:       callbacks,
 		pollExit:        make(chan any),
@@ -48,8 +56,11 @@ func NewClientTransport(
 
 func (t *ClientTransport) Name() string { return "polling" }
 
-func (t *ClientTransport) Handshake() (hr *parser.HandshakeResponse, err error) {
-	packets, err := t.poll()
+func (t *ClientTransport) Handshake(ctx context.Context) (hr *parser.HandshakeResponse, err error) {
+	var packets []*parser.Packet
+	err = t.poll(ctx, func(packet *parser.Packet) {
+		packets = append(packets, packet)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -98,18 +109,19 @@ func (t *ClientTransport) Run() {
 		case <-t.pollExit:
 			return
 		default:
-			packets, err := t.poll()
+			err := t.poll(context.Background(), func(packet *parser.Packet) {
+				t.callbacks.OnPacket(packet)
+			})
 			if err != nil {
 				t.close(err)
 				return
 			}
-			t.callbacks.OnPacket(packets...)
 		}
 	}
 }
 
-func (t *ClientTransport) newRequest(method string, body io.Reader, contentLength int) (*http.Request, error) {
-	req, err := http.NewRequest(method, t.url.String(), body)
+func (t *ClientTransport) newRequest(ctx context.Context, method string, body io.Reader, contentLength int) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url.String(), body)
 	if err != nil {
 		return nil, err
 	}
@@ -120,9 +132,12 @@ func (t *ClientTransport) newRequest(method string, body io.Reader, contentLengt
 	}
 
 	req.Header.Set("Accept", "*/*")
-	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
 
-	h := t.requestHeader.Header()
+	h, err := t.requestOptions.BuildHeader()
+	if err != nil {
+		return nil, err
+	}
 	for k, v := range h {
 		for _, s := range v {
 			req.Header.Set(k, s)
@@ -130,6 +145,10 @@ func (t *ClientTransport) newRequest(method string, body io.Reader, contentLengt
 	}
 
 	q := req.URL.Query()
+	err = t.requestOptions.BuildQuery(q)
+	if err != nil {
+		return nil, err
+	}
 	q.Set("transport", "polling")
 	q.Set("EIO", strconv.Itoa(t.protocolVersion))
 
@@ -141,28 +160,46 @@ func (t *ClientTransport) newRequest(method string, body io.Reader, contentLengt
 	return req, nil
 }
 
-func (t *ClientTransport) poll() ([]*parser.Packet, error) {
-	req, err := t.newRequest("GET", nil, 0)
+// Send a GET request and pass the packets of the response to onPacket as they are decoded.
+func (t *ClientTransport) poll(ctx context.Context, onPacket func(packet *parser.Packet)) error {
+	req, err := t.newRequest(ctx, "GET", nil, 0)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	resp, err := t.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("polling: non-200 HTTP response received. response code: %d", resp.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return &transport.HTTPError{StatusCode: resp.StatusCode, Body: body}
 	}
 
 	r, err := compressedReader(resp)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer r.Close()
-	return parser.DecodePayloads(r)
+
+	// The limit doesn't apply to the handshake response.
+	maxSize := t.maxBufferSize
+	if t.sid == "" {
+		maxSize = 0
+	}
+	d := parser.NewPayloadDecoder(r, maxSize, maxSize)
+	for {
+		packet, err := d.Decode()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		onPacket(packet)
+	}
 }
 
 func (t *ClientTransport) Send(packets ...*parser.Packet) {
@@ -175,7 +212,7 @@ func (t *ClientTransport) Send(packets ...*parser.Packet) {
 		return
 	}
 
-	req, err := t.newRequest("POST", &buf, buf.Len())
+	req, err := t.newRequest(context.Background(), "POST", &buf, buf.Len())
 	if err != nil {
 		t.close(err)
 		return
@@ -189,7 +226,8 @@ func (t *ClientTransport) Send(packets ...*parser.Packet) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		t.close(fmt.Errorf("polling: non-200 HTTP response received. response code: %d", resp.StatusCode))
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		t.close(&transport.HTTPError{StatusCode: resp.StatusCode, Body: body})
 		return
 	}
 
@@ -209,6 +247,7 @@ func (t *ClientTransport) Send(packets ...*parser.Packet) {
 		t.close(fmt.Errorf("polling: invalid response received"))
 		return
 	}
+	t.callbacks.OnSent(packets...)
 }
 
 func (t *ClientTransport) Discard() {
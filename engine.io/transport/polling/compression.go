@@ -1,9 +1,13 @@
 package polling
 
 import (
+	"bytes"
 	"compress/gzip"
+	"compress/zlib"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func compressedReader(resp *http.Response) (r io.ReadCloser, err error) {
@@ -13,8 +17,87 @@ func compressedReader(resp *http.Response) (r io.ReadCloser, err error) {
 		if err != nil {
 			return nil, err
 		}
+	case "deflate":
+		// The deflate content coding is the zlib format (RFC 9110, section 8.4.1.2).
+		r, err = zlib.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		r = resp.Body
 	}
 	return
 }
+
+// Return the content encoding to use for the response based on the Accept-Encoding header.
+// gzip is preferred over deflate. If neither is accepted, an empty string is returned.
+func acceptedEncoding(r *http.Request) string {
+	var (
+		gzipOK, deflateOK           bool
+		gzipRefused, deflateRefused bool
+		// `*` matches the codings that are not listed explicitly.
+		anyOK bool
+	)
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, token := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(token, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+
+			// A coding with q=0 is explicitly refused.
+			refused := false
+			for _, param := range strings.Split(params, ";") {
+				if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+					if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+						refused = true
+					}
+				}
+			}
+
+			switch coding {
+			case "gzip":
+				gzipOK, gzipRefused = !refused, refused
+			case "deflate":
+				deflateOK, deflateRefused = !refused, refused
+			case "*":
+				anyOK = !refused
+			}
+		}
+	}
+
+	switch {
+	case gzipOK || (anyOK && !gzipRefused):
+		return "gzip"
+	case deflateOK || (anyOK && !deflateRefused):
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+func compress(encoding string, level int, data []byte) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		cw  io.WriteCloser
+		err error
+	)
+	switch encoding {
+	case "gzip":
+		cw, err = gzip.NewWriterLevel(&buf, level)
+	default:
+		cw, err = zlib.NewWriterLevel(&buf, level)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cw.Write(data)
+	if err != nil {
+		cw.Close()
+		return nil, err
+	}
+	err = cw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
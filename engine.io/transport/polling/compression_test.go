@@ -1,7 +1,10 @@
 package polling
 
 import (
+	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +12,7 @@ import (
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/stretchr/testify/require"
+	"github.com/tomruk/socket.io-go/engine.io/parser"
 )
 
 func TestGzip(t *testing.T) {
@@ -52,6 +56,72 @@ func TestGzip(t *testing.T) {
 	require.Equal(t, loremIpsum, body, "the returned gzipped response should match the lorem ipsum text")
 }
 
+func TestDeflate(t *testing.T) {
+	compressed, err := compress("deflate", flate.DefaultCompression, loremIpsum)
+	require.NoError(t, err)
+
+	// The deflate content coding is the zlib format, not raw DEFLATE.
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, loremIpsum, body, "the deflated response should be decodable by zlib")
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Encoding", "deflate")
+	rec.WriteHeader(200)
+	rec.Write(deflatedHelloWorld)
+
+	cr, err := compressedReader(rec.Result())
+	require.NoError(t, err)
+	defer cr.Close()
+
+	body, err = io.ReadAll(cr)
+	require.NoError(t, err)
+	require.Equal(t, "4hello world", string(body), "a response deflated by zlib should be decoded")
+}
+
+// "4hello world" compressed by zlib.
+var deflatedHelloWorld = []byte{0x78, 0x9c, 0x33, 0xc9, 0x48, 0xcd, 0xc9, 0xc9, 0x57, 0x28, 0xcf, 0x2f, 0xca, 0x49, 0x01, 0x00, 0x1c, 0x7c, 0x04, 0x91}
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"gzip":                     "gzip",
+		"deflate":                  "deflate",
+		"deflate, gzip":            "gzip",
+		"gzip;q=0, deflate":        "deflate",
+		"gzip; q=0.000, deflate":   "deflate",
+		"GZIP;q=0.5":               "gzip",
+		"*":                        "gzip",
+		"br, deflate;q=0":          "",
+		"gzip;q=0, *":              "deflate",
+		"*, gzip;q=0":              "deflate",
+		"gzip;q=0, deflate;q=0, *": "",
+		"*;q=0":                    "",
+		"*;q=0, deflate":           "deflate",
+	}
+
+	for acceptEncoding, expected := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		require.Equal(t, expected, acceptedEncoding(req), "Accept-Encoding: %s", acceptEncoding)
+	}
+}
+
+func TestShouldCompress(t *testing.T) {
+	compressed := &parser.Packet{Type: parser.PacketTypeMessage, Data: []byte("compressed")}
+	uncompressed := &parser.Packet{Type: parser.PacketTypeMessage, Data: []byte("uncompressed"), SkipCompression: true}
+
+	require.True(t, shouldCompress([]*parser.Packet{compressed}))
+	require.True(t, shouldCompress([]*parser.Packet{uncompressed, compressed}))
+	require.False(t, shouldCompress([]*parser.Packet{uncompressed}))
+	require.False(t, shouldCompress([]*parser.Packet{uncompressed, uncompressed}))
+}
+
 var loremIpsum = []byte("Lorem ipsum dolor sit amet, consectetur adipiscing elit. Suspendisse placerat magna a vulputate lobortis. Vestibulum auctor sapien purus, sit amet blandit lectus semper id. Pellentesque aliquet, libero ac blandit consectetur, risus erat egestas lacus, et ullamcorper magna turpis id quam. Aenean ornare ex quis ante ullamcorper facilisis. Fusce pretium lacus in nunc viverra hendrerit. Mauris a leo leo. Ut tincidunt varius urna et mollis. Proin fermentum turpis at posuere condimentum. Aenean mollis varius orci eget suscipit. Integer luctus erat ligula, quis aliquet elit euismod et. Fusce sed leo ac est sollicitudin efficitur. Vestibulum sagittis augue non ex vestibulum sagittis. Aliquam erat volutpat. Donec non justo tortor. Aliquam cursus tristique nulla, et venenatis lacus vehicula ac. Nunc molestie nisi eros, sit amet porttitor enim ultricies at. Suspendisse suscipit sem eget diam bibendum, eu suscipit augue lobortis. Quisque ut nisi eget justo auctor viverra. Donec pellentesque nunc at velit ullamcorper, vehicula pharetra metus dignissim. Pellentesque sed sem egestas massa fringilla vehicula ut vel neque. Phasellus sed luctus lectus, quis luctus purus. Cras consequat mauris eu est rhoncus pellentesque ac non turpis. Proin ullamcorper vitae sem vitae ultrices. Integer scelerisque convallis tortor, vel pulvinar arcu aliquam at. Duis eu augue id felis laoreet tempor in a nibh. Suspendisse augue neque, egestas sed pellentesque cursus, sagittis sit amet lorem. Integer non tellus sem. Proin sapien augue, efficitur sed nibh eu, scelerisque bibendum leo.")
 
 func loremIpsumHandler(w http.ResponseWriter, r *http.Request) {
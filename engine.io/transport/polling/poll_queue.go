@@ -1,6 +1,7 @@
 package polling
 
 import (
+	"context"
 	"time"
 
 	"github.com/tomruk/socket.io-go/internal/sync"
@@ -11,12 +12,14 @@ import (
 type pollQueue struct {
 	packets []*parser.Packet
 	ready   chan struct{}
+	drain   chan struct{}
 	mu      sync.Mutex
 }
 
 func newPollQueue() *pollQueue {
 	return &pollQueue{
 		ready: make(chan struct{}),
+		drain: make(chan struct{}, 1),
 	}
 }
 
@@ -61,9 +64,29 @@ func (pq *pollQueue) get() []*parser.Packet {
 	packets := pq.packets
 	pq.packets = nil
 	pq.mu.Unlock()
+
+	if len(packets) > 0 {
+		// Signal waitForDrain (if any).
+		select {
+		case pq.drain <- struct{}{}:
+		default:
+		}
+	}
 	return packets
 }
 
+// Wait until the queue is empty or ctx is done.
+func (pq *pollQueue) waitForDrain(ctx context.Context) (drained bool) {
+	for pq.len() > 0 {
+		select {
+		case <-pq.drain:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
 func (pq *pollQueue) len() int {
 	pq.mu.Lock()
 	l := len(pq.packets)
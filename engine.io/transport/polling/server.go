@@ -2,6 +2,8 @@ package polling
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,14 +12,25 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/tomruk/socket.io-go/internal/bufpool"
 	"github.com/tomruk/socket.io-go/internal/sync"
 
 	"github.com/tomruk/socket.io-go/engine.io/parser"
 	"github.com/tomruk/socket.io-go/engine.io/transport"
 )
 
+var errJSONPDisabled = fmt.Errorf("polling: JSONP is disabled")
+
 type ServerTransport struct {
 	maxHTTPBufferSize int64
+	maxPacketSize     int64
+	allowJSONP        bool
+	protocolVersion   int
+
+	// Responses of the GET requests that are at least
+	// this long are compressed. 0 means compression is disabled.
+	compressionThreshold int
+	compressionLevel     int
 
 	pq          *pollQueue
 	pollTimeout time.Duration
@@ -26,12 +39,26 @@ type ServerTransport struct {
 	once      sync.Once
 }
 
-func NewServerTransport(callbacks *transport.Callbacks, maxBufferSize int64, pollTimeout time.Duration) *ServerTransport {
+func NewServerTransport(
+	callbacks *transport.Callbacks,
+	maxBufferSize int64,
+	maxPacketSize int64,
+	pollTimeout time.Duration,
+	allowJSONP bool,
+	compressionThreshold int,
+	compressionLevel int,
+	protocolVersion int,
+) *ServerTransport {
 	return &ServerTransport{
-		maxHTTPBufferSize: maxBufferSize,
-		pq:                newPollQueue(),
-		pollTimeout:       pollTimeout,
-		callbacks:         callbacks,
+		maxHTTPBufferSize:    maxBufferSize,
+		maxPacketSize:        maxPacketSize,
+		allowJSONP:           allowJSONP,
+		protocolVersion:      protocolVersion,
+		compressionThreshold: compressionThreshold,
+		compressionLevel:     compressionLevel,
+		pq:                   newPollQueue(),
+		pollTimeout:          pollTimeout,
+		callbacks:            callbacks,
 	}
 }
 
@@ -45,7 +72,16 @@ func (t *ServerTransport) QueuedPackets() []*parser.Packet {
 	return t.pq.get()
 }
 
+func (t *ServerTransport) WaitForDrain(ctx context.Context) (drained bool) {
+	return t.pq.waitForDrain(ctx)
+}
+
 func (t *ServerTransport) Handshake(handshakePacket *parser.Packet, w http.ResponseWriter, r *http.Request) (sid string, err error) {
+	_, _, err = t.jsonpIndex(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return "", err
+	}
 	if handshakePacket != nil {
 		t.Send(handshakePacket)
 	}
@@ -59,6 +95,12 @@ func (t *ServerTransport) PostHandshake(_ *parser.Packet) {
 }
 
 func (t *ServerTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _, err := t.jsonpIndex(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		t.handlePollRequest(w, r)
@@ -67,12 +109,81 @@ func (t *ServerTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Get the JSONP index from the `j` query parameter.
+// If this is not a JSONP request, isJSONP will be false.
+func (t *ServerTransport) jsonpIndex(r *http.Request) (index string, isJSONP bool, err error) {
+	q := r.URL.Query()
+	if !q.Has("j") {
+		return "", false, nil
+	}
+	if !t.allowJSONP {
+		return "", true, errJSONPDisabled
+	}
+
+	// Only digits are allowed. Otherwise arbitrary JavaScript could be injected into the response.
+	index = q.Get("j")
+	if index == "" {
+		return "", true, fmt.Errorf("polling: invalid JSONP index")
+	}
+	for _, c := range index {
+		if c < '0' || c > '9' {
+			return "", true, fmt.Errorf("polling: invalid JSONP index")
+		}
+	}
+	return index, true, nil
+}
+
 func (t *ServerTransport) setHeaders(w http.ResponseWriter, r *http.Request) {
 	wh := w.Header()
 	userAgent := r.UserAgent()
 	if strings.Contains(userAgent, ";MSIE") || strings.Contains(userAgent, "Trident/") {
 		wh.Set("X-XSS-Protection", "0")
 	}
+	if t.compressionThreshold > 0 {
+		wh.Add("Vary", "Accept-Encoding")
+	}
+}
+
+// Return the content encoding of a response body with the length of n.
+// If the response shouldn't be compressed, an empty string is returned.
+//
+// The response is not compressed if all of its packets have the SkipCompression field set.
+func (t *ServerTransport) contentEncoding(r *http.Request, n int, packets []*parser.Packet) string {
+	if t.compressionThreshold <= 0 || n < t.compressionThreshold || !shouldCompress(packets) {
+		return ""
+	}
+	return acceptedEncoding(r)
+}
+
+func shouldCompress(packets []*parser.Packet) bool {
+	for _, packet := range packets {
+		if !packet.SkipCompression {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress and write the body. ok is true if the response is written successfully.
+func (t *ServerTransport) writeCompressed(w http.ResponseWriter, encoding string, body []byte) (ok bool) {
+	compressed, err := compress(encoding, t.compressionLevel, body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		t.close(err)
+		return false
+	}
+
+	wh := w.Header()
+	wh.Set("Content-Encoding", encoding)
+	wh.Set("Content-Length", strconv.Itoa(len(compressed)))
+	w.WriteHeader(200)
+
+	_, err = w.Write(compressed)
+	if err != nil {
+		t.close(err)
+		return false
+	}
+	return true
 }
 
 func (t *ServerTransport) writeJSONPBody(w io.Writer, jsonp string, packets []*parser.Packet) error {
@@ -85,9 +196,12 @@ func (t *ServerTransport) writeJSONPBody(w io.Writer, jsonp string, packets []*p
 	}
 
 	buf := bytes.Buffer{}
-	buf.Grow(parser.EncodedPayloadsLen(packets...))
-
-	err = parser.EncodePayloads(&buf, packets...)
+	if t.protocolVersion == parser.ProtocolVersion3 {
+		err = parser.EncodePayloadsV3(&buf, false, packets...)
+	} else {
+		buf.Grow(parser.EncodedPayloadsLen(packets...))
+		err = parser.EncodePayloads(&buf, packets...)
+	}
 	if err != nil {
 		return err
 	}
@@ -99,21 +213,48 @@ func (t *ServerTransport) writeJSONPBody(w io.Writer, jsonp string, packets []*p
 
 func (t *ServerTransport) handlePollRequest(w http.ResponseWriter, r *http.Request) {
 	packets := t.pq.poll(t.pollTimeout)
+	// The packets are sent only if the response is written successfully.
+	ok := t.writePollResponse(w, r, packets)
+	if ok && len(packets) > 0 {
+		t.callbacks.OnSent(packets...)
+	}
+}
 
-	jsonp := r.URL.Query().Get("j")
+// Write the packets as the response of a GET request. ok is true if the response is written successfully.
+func (t *ServerTransport) writePollResponse(w http.ResponseWriter, r *http.Request, packets []*parser.Packet) (ok bool) {
+	jsonp, isJSONP, _ := t.jsonpIndex(r)
 	wh := w.Header()
 	t.setHeaders(w, r)
 
+	if !isJSONP && t.protocolVersion == parser.ProtocolVersion3 {
+		return t.writePayloadsV3(w, r, packets)
+	}
+
 	// If this is not a JSON-P request
-	if jsonp == "" {
+	if !isJSONP {
+		n := parser.EncodedPayloadsLen(packets...)
 		wh.Set("Content-Type", "text/plain; charset=UTF-8")
-		wh.Set("Content-Length", strconv.Itoa(parser.EncodedPayloadsLen(packets...)))
+
+		if encoding := t.contentEncoding(r, n, packets); encoding != "" {
+			buf := bufpool.Get()
+			defer bufpool.Put(buf)
+			buf.Grow(n)
+			err := parser.EncodePayloads(buf, packets...)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				t.close(err)
+				return false
+			}
+			return t.writeCompressed(w, encoding, buf.Bytes())
+		}
+
+		wh.Set("Content-Length", strconv.Itoa(n))
 		w.WriteHeader(200)
 
 		err := parser.EncodePayloads(w, packets...)
 		if err != nil {
 			t.close(err)
-			return
+			return false
 		}
 	} else {
 		buf := bytes.Buffer{}
@@ -121,19 +262,86 @@ func (t *ServerTransport) handlePollRequest(w http.ResponseWriter, r *http.Reque
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			t.close(err)
-			return
+			return false
 		}
 
 		wh.Set("Content-Type", "text/javascript; charset=UTF-8")
+		if encoding := t.contentEncoding(r, buf.Len(), packets); encoding != "" {
+			return t.writeCompressed(w, encoding, buf.Bytes())
+		}
 		wh.Set("Content-Length", strconv.Itoa(buf.Len()))
 		w.WriteHeader(200)
 
 		_, err = w.Write(buf.Bytes())
 		if err != nil {
 			t.close(err)
-			return
+			return false
 		}
 	}
+	return true
+}
+
+// Write the packets as an Engine.IO v3 payload. The binary payload format is used
+// if the client supports binary (b64 query parameter is not set) and there are binary packets.
+func (t *ServerTransport) writePayloadsV3(w http.ResponseWriter, r *http.Request, packets []*parser.Packet) (ok bool) {
+	binaryPayload := r.URL.Query().Get("b64") == "" && parser.HasBinary(packets...)
+
+	buf := bytes.Buffer{}
+	err := parser.EncodePayloadsV3(&buf, binaryPayload, packets...)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		t.close(err)
+		return false
+	}
+
+	wh := w.Header()
+	if binaryPayload {
+		wh.Set("Content-Type", "application/octet-stream")
+	} else {
+		wh.Set("Content-Type", "text/plain; charset=UTF-8")
+	}
+
+	if encoding := t.contentEncoding(r, buf.Len(), packets); encoding != "" {
+		return t.writeCompressed(w, encoding, buf.Bytes())
+	}
+	wh.Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(200)
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		t.close(err)
+		return false
+	}
+	return true
+}
+
+// Decode the payload and pass the packets to the OnPacket callback as they are decoded.
+func (t *ServerTransport) decodePayloads(r io.Reader, binaryPayload bool) error {
+	if t.protocolVersion == parser.ProtocolVersion3 {
+		packets, err := parser.DecodePayloadsV3(r, binaryPayload)
+		if err != nil {
+			return err
+		}
+		t.callbacks.OnPacket(packets...)
+		return nil
+	}
+
+	d := parser.NewPayloadDecoder(r, t.maxPacketSize, t.maxHTTPBufferSize)
+	for {
+		packet, err := d.Decode()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		t.callbacks.OnPacket(packet)
+	}
+}
+
+func isTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr) || errors.Is(err, parser.ErrPacketTooLarge) || errors.Is(err, parser.ErrPayloadTooLarge)
 }
 
 var (
@@ -150,22 +358,30 @@ func (t *ServerTransport) handleDataRequest(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	var (
-		packets []*parser.Packet
-		jsonp   = r.URL.Query().Get("j")
-		err     error
-	)
+	// The Content-Length check doesn't cover the chunked requests.
+	if t.maxHTTPBufferSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, t.maxHTTPBufferSize)
+	}
+	_, isJSONP, _ := t.jsonpIndex(r)
 
 	// If this is not a JSON-P request
-	if jsonp == "" {
-		packets, err = parser.DecodePayloads(r.Body)
-		if err != nil {
+	if !isJSONP {
+		// Engine.IO v3 clients send binary payloads with this content type.
+		binaryPayload := r.Header.Get("Content-Type") == "application/octet-stream"
+		err := t.decodePayloads(r.Body, binaryPayload)
+		if isTooLarge(err) {
+			defer t.close(fmt.Errorf("polling: maxHTTPBufferSize (MaxBufferSize) exceeded"))
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			r.Close = true
+			r.Body.Close()
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			t.close(err)
 			return
 		}
 	} else {
-		err = r.ParseForm()
+		err := r.ParseForm()
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			t.close(err)
@@ -176,7 +392,7 @@ func (t *ServerTransport) handleDataRequest(w http.ResponseWriter, r *http.Reque
 		d = slashReplacer.Replace(d)
 		buf := bytes.NewBuffer([]byte(d))
 
-		packets, err = parser.DecodePayloads(buf)
+		err = t.decodePayloads(buf, false)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			t.close(err)
@@ -184,8 +400,6 @@ func (t *ServerTransport) handleDataRequest(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	t.callbacks.OnPacket(packets...)
-
 	t.setHeaders(w, r)
 	wh := w.Header()
 
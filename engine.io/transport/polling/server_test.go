@@ -0,0 +1,53 @@
+package polling
+
+import (
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomruk/socket.io-go/engine.io/parser"
+	"github.com/tomruk/socket.io-go/engine.io/transport"
+)
+
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingResponseWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestServerTransportOnSent(t *testing.T) {
+	newTransport := func(sent *atomic.Int32) *ServerTransport {
+		c := transport.NewCallbacks()
+		c.SetOnSent(func(packets ...*parser.Packet) {
+			sent.Add(int32(len(packets)))
+		})
+		return NewServerTransport(c, 0, 0, 10*time.Millisecond, false, 0, 0, parser.ProtocolVersion)
+	}
+	p, err := parser.NewPacket(parser.PacketTypeMessage, false, []byte("hello"))
+	require.NoError(t, err)
+
+	t.Run("should call OnSent after the packets are written", func(t *testing.T) {
+		var sent atomic.Int32
+		tr := newTransport(&sent)
+		tr.Send(p)
+
+		rec := httptest.NewRecorder()
+		tr.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		require.Equal(t, "4hello", rec.Body.String())
+		require.Equal(t, int32(1), sent.Load())
+	})
+
+	t.Run("should not call OnSent if the write fails", func(t *testing.T) {
+		var sent atomic.Int32
+		tr := newTransport(&sent)
+		tr.Send(p)
+
+		tr.ServeHTTP(failingResponseWriter{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+		require.Zero(t, sent.Load())
+	})
+}
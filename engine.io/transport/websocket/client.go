@@ -2,6 +2,8 @@ package websocket
 
 import (
 	"context"
+	"io"
+	"net/http"
 	"net/url"
 	"strconv"
 
@@ -16,10 +18,12 @@ type ClientTransport struct {
 	sid             string
 	protocolVersion int
 	url             *url.URL
-	requestHeader   *transport.RequestHeader
+	requestOptions  *transport.RequestOptions
+	readLimit       int64
 
 	dialOptions *websocket.DialOptions
 	conn        *websocket.Conn
+	compress    bool
 
 	callbacks *transport.Callbacks
 	once      sync.Once
@@ -30,23 +34,30 @@ func NewClientTransport(
 	sid string,
 	protocolVersion int,
 	url url.URL,
-	requestHeader *transport.RequestHeader,
+	requestOptions *transport.RequestOptions,
 	dialOptions *websocket.DialOptions,
+	maxBufferSize int64,
 ) *ClientTransport {
 	return &ClientTransport{
 		sid:             sid,
+		readLimit:       maxBufferSize,
 		protocolVersion: protocolVersion,
 		url:             &url,
-		requestHeader:   requestHeader,
+		requestOptions:  requestOptions,
 		callbacks:       callbacks,
 		dialOptions:     dialOptions,
+		compress:        dialOptions != nil && dialOptions.CompressionMode != websocket.CompressionDisabled,
 	}
 }
 
 func (t *ClientTransport) Name() string { return "websocket" }
 
-func (t *ClientTransport) Handshake() (hr *parser.HandshakeResponse, err error) {
+func (t *ClientTransport) Handshake(ctx context.Context) (hr *parser.HandshakeResponse, err error) {
 	q := t.url.Query()
+	err = t.requestOptions.BuildQuery(q)
+	if err != nil {
+		return nil, err
+	}
 	q.Set("transport", "websocket")
 	q.Set("EIO", strconv.Itoa(t.protocolVersion))
 	if t.sid != "" {
@@ -61,12 +72,25 @@ func (t *ClientTransport) Handshake() (hr *parser.HandshakeResponse, err error)
 		t.url.Scheme = "ws"
 	}
 
-	if t.requestHeader != nil {
-		t.dialOptions.HTTPHeader = t.requestHeader.Header()
+	header, err := t.requestOptions.BuildHeader()
+	if err != nil {
+		return nil, err
 	}
+	// Copy the options, since they are shared by the transports of the client.
+	dialOptions := *t.dialOptions
+	dialOptions.HTTPHeader = header
+
+	ctx, stop := transport.HandshakeContext(ctx)
+	defer stop()
 
-	t.conn, _, err = websocket.Dial(context.Background(), t.url.String(), t.dialOptions)
+	var resp *http.Response
+	t.conn, resp, err = websocket.Dial(ctx, t.url.String(), &dialOptions)
 	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			// The websocket package reads up to 1024 bytes of the body on failure.
+			body, _ := io.ReadAll(resp.Body)
+			return nil, &transport.HTTPError{StatusCode: resp.StatusCode, Body: body}
+		}
 		return
 	}
 
@@ -75,7 +99,7 @@ func (t *ClientTransport) Handshake() (hr *parser.HandshakeResponse, err error)
 
 	// If sid is not set, we should receive the OPEN packet and return the values decoded from it.
 	if t.sid == "" {
-		p, err := t.nextPacket()
+		p, err := t.nextPacket(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -88,12 +112,16 @@ func (t *ClientTransport) Handshake() (hr *parser.HandshakeResponse, err error)
 		t.sid = hr.SID
 	}
 
+	// The limit doesn't apply to the OPEN packet.
+	if t.readLimit != 0 {
+		t.conn.SetReadLimit(t.readLimit)
+	}
 	return
 }
 
 func (t *ClientTransport) Run() {
 	for {
-		packet, err := t.nextPacket()
+		packet, err := t.nextPacket(context.Background())
 		if err != nil {
 			t.close(err)
 			return
@@ -102,12 +130,12 @@ func (t *ClientTransport) Run() {
 	}
 }
 
-func (t *ClientTransport) nextPacket() (*parser.Packet, error) {
-	mt, r, err := t.conn.Reader(context.Background())
+func (t *ClientTransport) nextPacket(ctx context.Context) (*parser.Packet, error) {
+	mt, r, err := t.conn.Reader(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return parser.Decode(r, mt == websocket.MessageBinary)
+	return decodePacket(r, mt == websocket.MessageBinary, t.protocolVersion)
 }
 
 func (t *ClientTransport) Send(packets ...*parser.Packet) {
@@ -117,23 +145,12 @@ func (t *ClientTransport) Send(packets ...*parser.Packet) {
 			t.close(err)
 			break
 		}
+		t.callbacks.OnSent(packet)
 	}
 }
 
 func (t *ClientTransport) send(packet *parser.Packet) error {
-	var mt websocket.MessageType
-	if packet.IsBinary {
-		mt = websocket.MessageBinary
-	} else {
-		mt = websocket.MessageText
-	}
-
-	w, err := t.conn.Writer(context.Background(), mt)
-	if err != nil {
-		return err
-	}
-	defer w.Close()
-	return packet.Encode(w, true)
+	return writePacket(context.Background(), t.conn, packet, t.compress, t.protocolVersion)
 }
 
 func (t *ClientTransport) Discard() {
@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"context"
+	"io"
+
+	"github.com/tomruk/socket.io-go/engine.io/parser"
+	"github.com/tomruk/socket.io-go/internal/bufpool"
+	"nhooyr.io/websocket"
+)
+
+func writePacket(ctx context.Context, conn *websocket.Conn, packet *parser.Packet, compress bool, protocolVersion int) error {
+	var mt websocket.MessageType
+	if packet.IsBinary {
+		mt = websocket.MessageBinary
+	} else {
+		mt = websocket.MessageText
+	}
+
+	// The websocket package decides whether to compress a message on its first write:
+	// the message is compressed only if the first write is at least CompressionThreshold bytes long.
+	//
+	// A packet to compress is written with a single write, so that the threshold applies to the size of the message.
+	if compress && !packet.SkipCompression {
+		var (
+			buf = bufpool.Get()
+			err error
+		)
+		defer bufpool.Put(buf)
+		if protocolVersion == parser.ProtocolVersion3 {
+			buf.Grow(packet.EncodedLenV3(true))
+			err = packet.EncodeV3(buf, true)
+		} else {
+			buf.Grow(packet.EncodedLen(true))
+			err = packet.Encode(buf, true)
+		}
+		if err != nil {
+			return err
+		}
+		return conn.Write(ctx, mt, buf.Bytes())
+	}
+
+	w, err := conn.Writer(ctx, mt)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if compress {
+		// An empty first write (an empty first frame) keeps the message uncompressed, whatever the threshold is.
+		_, err = w.Write(nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if protocolVersion == parser.ProtocolVersion3 {
+		return packet.EncodeV3(w, true)
+	}
+	return packet.Encode(w, true)
+}
+
+func decodePacket(r io.Reader, binaryFrame bool, protocolVersion int) (*parser.Packet, error) {
+	if protocolVersion == parser.ProtocolVersion3 {
+		return parser.DecodeV3(r, binaryFrame)
+	}
+	return parser.Decode(r, binaryFrame)
+}
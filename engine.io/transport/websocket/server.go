@@ -12,9 +12,11 @@ import (
 )
 
 type ServerTransport struct {
-	readLimit      int64
-	supportsBinary bool
-	acceptOptions  *websocket.AcceptOptions
+	readLimit       int64
+	supportsBinary  bool
+	protocolVersion int
+	acceptOptions   *websocket.AcceptOptions
+	compress        bool
 
 	ctx  context.Context
 	conn *websocket.Conn
@@ -27,13 +29,16 @@ func NewServerTransport(
 	callbacks *transport.Callbacks,
 	maxBufferSize int64,
 	supportsBinary bool,
+	protocolVersion int,
 	acceptOptions *websocket.AcceptOptions,
 ) *ServerTransport {
 	return &ServerTransport{
-		readLimit:      maxBufferSize,
-		supportsBinary: supportsBinary,
-		callbacks:      callbacks,
-		acceptOptions:  acceptOptions,
+		readLimit:       maxBufferSize,
+		supportsBinary:  supportsBinary,
+		protocolVersion: protocolVersion,
+		callbacks:       callbacks,
+		acceptOptions:   acceptOptions,
+		compress:        acceptOptions != nil && acceptOptions.CompressionMode != websocket.CompressionDisabled,
 	}
 }
 
@@ -44,6 +49,11 @@ func (t *ServerTransport) QueuedPackets() []*parser.Packet {
 	return nil
 }
 
+func (t *ServerTransport) WaitForDrain(_ context.Context) (drained bool) {
+	// There's no queue on WebSocket. Packets are directly sent.
+	return true
+}
+
 func (t *ServerTransport) Send(packets ...*parser.Packet) {
 	for _, packet := range packets {
 		err := t.send(packet)
@@ -51,23 +61,12 @@ func (t *ServerTransport) Send(packets ...*parser.Packet) {
 			t.close(err)
 			break
 		}
+		t.callbacks.OnSent(packet)
 	}
 }
 
 func (t *ServerTransport) send(packet *parser.Packet) error {
-	var mt websocket.MessageType
-	if packet.IsBinary {
-		mt = websocket.MessageBinary
-	} else {
-		mt = websocket.MessageText
-	}
-
-	w, err := t.conn.Writer(t.ctx, mt)
-	if err != nil {
-		return err
-	}
-	defer w.Close()
-	return packet.Encode(w, true)
+	return writePacket(t.ctx, t.conn, packet, t.compress, t.protocolVersion)
 }
 
 func (t *ServerTransport) Handshake(handshakePacket *parser.Packet, w http.ResponseWriter, r *http.Request) (sid string, err error) {
@@ -117,7 +116,7 @@ func (t *ServerTransport) nextPacket() (*parser.Packet, error) {
 	if err != nil {
 		return nil, err
 	}
-	return parser.Decode(r, mt == websocket.MessageBinary)
+	return decodePacket(r, mt == websocket.MessageBinary, t.protocolVersion)
 }
 
 func (t *ServerTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
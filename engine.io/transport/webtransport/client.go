@@ -16,7 +16,7 @@ type ClientTransport struct {
 	sid             string
 	protocolVersion int
 	url             *url.URL
-	requestHeader   *transport.RequestHeader
+	requestOptions  *transport.RequestOptions
 
 	dialer *webtransport.Dialer
 	stream webtransport.Stream
@@ -31,7 +31,7 @@ func NewClientTransport(
 	sid string,
 	protocolVersion int,
 	url url.URL,
-	requestHeader *transport.RequestHeader,
+	requestOptions *transport.RequestOptions,
 	dialer *webtransport.Dialer,
 ) *ClientTransport {
 	return &ClientTransport{
@@ -39,7 +39,7 @@ func NewClientTransport(
 
 		protocolVersion: protocolVersion,
 		url:             &url,
-		requestHeader:   requestHeader,
+		requestOptions:  requestOptions,
 
 		callbacks: callbacks,
 
@@ -49,7 +49,7 @@ func NewClientTransport(
 
 func (t *ClientTransport) Name() string { return "webtransport" }
 
-func (t *ClientTransport) Handshake() (hr *parser.HandshakeResponse, err error) {
+func (t *ClientTransport) Handshake(ctx context.Context) (hr *parser.HandshakeResponse, err error) {
 	switch t.url.Scheme {
 	case "wss":
 		t.url.Scheme = "https"
@@ -57,10 +57,28 @@ func (t *ClientTransport) Handshake() (hr *parser.HandshakeResponse, err error)
 		t.url.Scheme = "http"
 	}
 
-	_, session, err := t.dialer.Dial(context.Background(), t.url.String(), t.requestHeader.Header())
+	q := t.url.Query()
+	err = t.requestOptions.BuildQuery(q)
 	if err != nil {
 		return nil, err
 	}
+	t.url.RawQuery = q.Encode()
+
+	header, err := t.requestOptions.BuildHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, stop := transport.HandshakeContext(ctx)
+	defer stop()
+
+	_, session, err := t.dialer.Dial(ctx, t.url.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	// Bound the rest of the handshake with ctx.
+	stopClose := context.AfterFunc(ctx, func() { session.CloseWithError(0, "") })
+	defer stopClose()
 
 	t.stream, err = session.OpenStream()
 	if err != nil {
@@ -126,6 +144,7 @@ func (t *ClientTransport) Send(packets ...*parser.Packet) {
 			t.close(err)
 			break
 		}
+		t.callbacks.OnSent(packet)
 	}
 }
 
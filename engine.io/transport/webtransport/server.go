@@ -46,6 +46,11 @@ func (t *ServerTransport) QueuedPackets() []*parser.Packet {
 	return nil
 }
 
+func (t *ServerTransport) WaitForDrain(_ context.Context) (drained bool) {
+	// There's no queue on WebTransport. Packets are directly sent.
+	return true
+}
+
 func (t *ServerTransport) Send(packets ...*parser.Packet) {
 	for _, packet := range packets {
 		err := t.send(packet)
@@ -53,6 +58,7 @@ func (t *ServerTransport) Send(packets ...*parser.Packet) {
 			t.close(err)
 			break
 		}
+		t.callbacks.OnSent(packet)
 	}
 }
 
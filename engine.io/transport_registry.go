@@ -0,0 +1,265 @@
+package eio
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/tomruk/socket.io-go/internal/sync"
+
+	"github.com/tomruk/socket.io-go/engine.io/transport"
+	"github.com/tomruk/socket.io-go/engine.io/transport/memory"
+	"github.com/tomruk/socket.io-go/engine.io/transport/polling"
+	"github.com/tomruk/socket.io-go/engine.io/transport/websocket"
+	"github.com/tomruk/socket.io-go/engine.io/transport/webtransport"
+)
+
+type (
+	// Options that are passed to ServerTransportFactory.
+	ServerTransportOptions struct {
+		// Callbacks of the transport. The transport must call them when a packet is received and when it is closed.
+		Callbacks *transport.Callbacks
+
+		// Engine.IO protocol version of the client.
+		ProtocolVersion int
+
+		// Whether the client supports binary packets (the `b64` query parameter is not set).
+		SupportsBinary bool
+
+		// Maximum size of the incoming messages. 0 means unlimited.
+		MaxBufferSize int64
+
+		// The handshake (or upgrade) request.
+		Request *http.Request
+
+		// This is used by the built-in transports.
+		server *Server
+	}
+
+	// Create a server transport.
+	//
+	// If a non-nil error is returned, the handshake (or upgrade) is rejected with ErrorBadRequest.
+	ServerTransportFactory func(options *ServerTransportOptions) (ServerTransport, error)
+
+	// Options that are passed to ClientTransportFactory.
+	ClientTransportOptions struct {
+		// Callbacks of the transport. The transport must call them when a packet is received and when it is closed.
+		Callbacks *transport.Callbacks
+
+		// Session ID. If this is not empty, the transport is created to upgrade an existing connection.
+		SID string
+
+		// Engine.IO protocol version to use.
+		ProtocolVersion int
+
+		// URL of the server.
+		URL url.URL
+
+		// HTTP headers and query parameters to use. Build them before every request.
+		RequestOptions *transport.RequestOptions
+
+		// Maximum size of the incoming packets. 0 means unlimited.
+		MaxBufferSize int64
+
+		// HTTP client to use. This is configured with ClientConfig.HTTPTransport and ClientConfig.CookieJar.
+		HTTPClient *http.Client
+
+		// This is used by the built-in transports.
+		socket *clientSocket
+	}
+
+	// Create a client transport.
+	//
+	// If a non-nil error is returned, the transport is skipped (as if its handshake failed).
+	ClientTransportFactory func(options *ClientTransportOptions) (ClientTransport, error)
+
+	serverTransportEntry struct {
+		factory      ServerTransportFactory
+		upgradesFrom []string
+	}
+)
+
+var (
+	serverTransports   = make(map[string]*serverTransportEntry)
+	serverTransportsMu sync.RWMutex
+
+	clientTransports   = make(map[string]ClientTransportFactory)
+	clientTransportsMu sync.RWMutex
+)
+
+func init() {
+	RegisterServerTransport("polling", newPollingServerTransport)
+	RegisterServerTransport("websocket", newWebSocketServerTransport, "polling")
+	RegisterServerTransport("webtransport", newWebTransportServerTransport, "polling", "websocket")
+	RegisterServerTransport("memory", newMemoryServerTransport)
+
+	RegisterClientTransport("polling", newPollingClientTransport)
+	RegisterClientTransport("websocket", newWebSocketClientTransport)
+	RegisterClientTransport("webtransport", newWebTransportClientTransport)
+	RegisterClientTransport("memory", newMemoryClientTransport)
+}
+
+// Register a server transport with the given name.
+// To accept the connections of the transport, add its name to ServerConfig.Transports.
+//
+// upgradesFrom is the names of the transports that can be upgraded to this transport.
+// For example, the websocket transport is registered with upgradesFrom set to "polling".
+//
+// If a transport with the same name is already registered, it is replaced.
+// This function is meant to be called from an init function.
+func RegisterServerTransport(name string, factory ServerTransportFactory, upgradesFrom ...string) {
+	serverTransportsMu.Lock()
+	defer serverTransportsMu.Unlock()
+	serverTransports[name] = &serverTransportEntry{
+		factory:      factory,
+		upgradesFrom: upgradesFrom,
+	}
+}
+
+// Register a client transport with the given name.
+// To use the transport, add its name to ClientConfig.Transports.
+//
+// If a transport with the same name is already registered, it is replaced.
+// This function is meant to be called from an init function.
+func RegisterClientTransport(name string, factory ClientTransportFactory) {
+	clientTransportsMu.Lock()
+	defer clientTransportsMu.Unlock()
+	clientTransports[name] = factory
+}
+
+func getServerTransport(name string) (entry *serverTransportEntry, ok bool) {
+	serverTransportsMu.RLock()
+	defer serverTransportsMu.RUnlock()
+	entry, ok = serverTransports[name]
+	return
+}
+
+func getClientTransport(name string) (factory ClientTransportFactory, ok bool) {
+	clientTransportsMu.RLock()
+	defer clientTransportsMu.RUnlock()
+	factory, ok = clientTransports[name]
+	return
+}
+
+// Whether a client using the transport `from` can upgrade to the transport `to`.
+func canUpgrade(from, to string) bool {
+	entry, ok := getServerTransport(to)
+	return ok && slices.Contains(entry.upgradesFrom, from)
+}
+
+func (s *Server) newTransport(
+	name string,
+	c *transport.Callbacks,
+	protocolVersion int,
+	supportsBinary bool,
+	r *http.Request,
+) (ServerTransport, error) {
+	entry, ok := getServerTransport(name)
+	if !ok {
+		return nil, fmt.Errorf("eio: transport is not registered: %s", name)
+	}
+	t, err := entry.factory(&ServerTransportOptions{
+		Callbacks:       c,
+		ProtocolVersion: protocolVersion,
+		SupportsBinary:  supportsBinary,
+		MaxBufferSize:   s.maxBufferSize,
+		Request:         r,
+		server:          s,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.faultInjector.wrapServerTransport(t), nil
+}
+
+func (s *clientSocket) newTransport(name string, c *transport.Callbacks, sid string) (ClientTransport, error) {
+	factory, ok := getClientTransport(name)
+	if !ok {
+		return nil, fmt.Errorf("eio: invalid transport name: %s", name)
+	}
+	t, err := factory(&ClientTransportOptions{
+		Callbacks:       c,
+		SID:             sid,
+		ProtocolVersion: ProtocolVersion,
+		URL:             *s.url,
+		RequestOptions:  s.requestOptions,
+		MaxBufferSize:   s.maxBufferSize,
+		HTTPClient:      s.httpClient,
+		socket:          s,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.faultInjector.wrapClientTransport(t), nil
+}
+
+func newPollingServerTransport(o *ServerTransportOptions) (ServerTransport, error) {
+	s := o.server
+	if s == nil {
+		return nil, fmt.Errorf("eio: polling transport can only be created by the server")
+	}
+	return polling.NewServerTransport(
+		o.Callbacks,
+		o.MaxBufferSize,
+		s.maxPacketSize,
+		s.PollTimeout(),
+		!s.disableJSONP,
+		s.httpCompressionThreshold,
+		s.httpCompressionLevel,
+		o.ProtocolVersion,
+	), nil
+}
+
+func newWebSocketServerTransport(o *ServerTransportOptions) (ServerTransport, error) {
+	s := o.server
+	if s == nil {
+		return nil, fmt.Errorf("eio: websocket transport can only be created by the server")
+	}
+	return websocket.NewServerTransport(o.Callbacks, o.MaxBufferSize, o.SupportsBinary, o.ProtocolVersion, s.wsAcceptOptions), nil
+}
+
+func newWebTransportServerTransport(o *ServerTransportOptions) (ServerTransport, error) {
+	s := o.server
+	if s == nil || s.webTransportServer == nil {
+		return nil, fmt.Errorf("eio: webtransport transport requires WebTransportServer to be set")
+	}
+	if o.Request.ProtoMajor != 3 || o.Request.Method != "CONNECT" {
+		return nil, fmt.Errorf("eio: webtransport connections must be made with an HTTP/3 CONNECT request")
+	}
+	return webtransport.NewServerTransport(o.Callbacks, o.MaxBufferSize, s.webTransportServer), nil
+}
+
+func newMemoryServerTransport(o *ServerTransportOptions) (ServerTransport, error) {
+	t, err := memory.NewServerTransport(o.Callbacks, o.MaxBufferSize, o.Request)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func newPollingClientTransport(o *ClientTransportOptions) (ClientTransport, error) {
+	return polling.NewClientTransport(o.Callbacks, o.ProtocolVersion, o.URL, o.RequestOptions, o.HTTPClient, o.MaxBufferSize), nil
+}
+
+func newWebSocketClientTransport(o *ClientTransportOptions) (ClientTransport, error) {
+	if o.socket == nil {
+		return nil, fmt.Errorf("eio: websocket transport can only be created by the client")
+	}
+	return websocket.NewClientTransport(o.Callbacks, o.SID, o.ProtocolVersion, o.URL, o.RequestOptions, o.socket.wsDialOptions, o.MaxBufferSize), nil
+}
+
+func newWebTransportClientTransport(o *ClientTransportOptions) (ClientTransport, error) {
+	if o.socket == nil {
+		return nil, fmt.Errorf("eio: webtransport transport can only be created by the client")
+	}
+	err := o.socket.dialer.checkNoProxy(&o.URL)
+	if err != nil {
+		return nil, err
+	}
+	return webtransport.NewClientTransport(o.Callbacks, o.SID, o.ProtocolVersion, o.URL, o.RequestOptions, o.socket.webTransportDialer), nil
+}
+
+func newMemoryClientTransport(o *ClientTransportOptions) (ClientTransport, error) {
+	return memory.NewClientTransport(o.Callbacks, o.SID, o.ProtocolVersion, o.URL, o.RequestOptions), nil
+}
@@ -1,6 +1,7 @@
 package eio
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
@@ -120,6 +121,8 @@ func (s *TestSocket) TransportName() string { return "polling" }
 
 func (s *TestSocket) Send(packets ...*parser.Packet) { s.SendFunc(packets...) }
 
+func (s *TestSocket) Stats() SocketStats { return SocketStats{TransportName: "polling"} }
+
 func (s *TestSocket) Close() { s.Closed = true }
 
 type testServerTransport struct {
@@ -150,6 +153,8 @@ func (t *testServerTransport) ServeHTTP(w http.ResponseWriter, r *http.Request)
 
 func (t *testServerTransport) QueuedPackets() []*parser.Packet { return nil }
 
+func (t *testServerTransport) WaitForDrain(ctx context.Context) (drained bool) { return true }
+
 func (t *testServerTransport) Send(packets ...*parser.Packet) {}
 
 func (t *testServerTransport) Discard() {}
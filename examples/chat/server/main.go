@@ -4,16 +4,35 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	sio "github.com/tomruk/socket.io-go"
+	eio "github.com/tomruk/socket.io-go/engine.io"
 )
 
 const addr = "127.0.0.1:3000"
 
+// Used for the CORS configuration. If this value is empty, CORS will not be enabled.
+var allowOrigin = os.Getenv("ALLOW_ORIGIN")
+
 func main() {
-	io := sio.NewServer(nil)
+	config := new(sio.ServerConfig)
+
+	if allowOrigin != "" {
+		if !strings.HasPrefix(allowOrigin, "http://") {
+			allowOrigin = "http://" + allowOrigin
+		}
+		fmt.Printf("ALLOW_ORIGIN is set to: %s\n", allowOrigin)
+
+		config.EIO.CORS = &eio.CORSConfig{
+			AllowedOrigins:   []string{allowOrigin},
+			AllowCredentials: true,
+		}
+	}
+
+	io := sio.NewServer(config)
 
 	api := newAPI()
 	api.setup(io.Of("/"))
@@ -26,22 +45,9 @@ func main() {
 	fs := http.FileServer(http.Dir("public"))
 	router := http.NewServeMux()
 
-	if allowOrigin == "" {
-		// Make sure to have a slash at the end of the URL.
-		// Otherwise instead of matching with this handler, requests might match with a file that has an socket.io prefix (such as socket.io.min.js).
-		router.Handle("/socket.io/", io)
-	} else {
-		if !strings.HasPrefix(allowOrigin, "http://") {
-			allowOrigin = "http://" + allowOrigin
-		}
-
-		fmt.Printf("ALLOW_ORIGIN is set to: %s\n", allowOrigin)
-		h := corsMiddleware(io, allowOrigin)
-
-		// Make sure to have a slash at the end of the URL.
-		// Otherwise instead of matching with this handler, requests might match with a file that has an socket.io prefix (such as socket.io.min.js).
-		router.Handle("/socket.io/", h)
-	}
+	// Make sure to have a slash at the end of the URL.
+	// Otherwise instead of matching with this handler, requests might match with a file that has an socket.io prefix (such as socket.io.min.js).
+	router.Handle("/socket.io/", io)
 	router.Handle("/", fs)
 
 	server := &http.Server{
@@ -0,0 +1,31 @@
+// Package bufpool is a pool of the buffers used to encode packets.
+package bufpool
+
+import (
+	"bytes"
+
+	"github.com/tomruk/socket.io-go/internal/sync"
+)
+
+// Buffers larger than this are not put back into the pool,
+// so that a few large packets don't keep a lot of memory allocated.
+const maxPooledBufferSize = 64 * 1024
+
+var pool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// Get an empty buffer from the pool. Put it back with Put once it is no longer used.
+func Get() *bytes.Buffer {
+	buf := pool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// Put the buffer back into the pool. The buffer (and the slices returned by its Bytes method) must not be used afterwards.
+func Put(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	pool.Put(buf)
+}
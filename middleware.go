@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"reflect"
 	"time"
+
+	eio "github.com/tomruk/socket.io-go/engine.io"
 )
 
 type NspMiddlewareFunc func(socket ServerSocket, handshake *Handshake) error
@@ -15,6 +17,11 @@ type Handshake struct {
 
 	// Authentication data
 	Auth json.RawMessage
+
+	// The HTTP request that established the underlying Engine.IO connection
+	// (headers, query, client address, etc.).
+	// Sockets of the same client (connected to different namespaces) share the same value.
+	*eio.Handshake
 }
 
 func (n *Namespace) Use(f NspMiddlewareFunc) {
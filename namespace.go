@@ -125,7 +125,9 @@ func (n *Namespace) Except(room ...Room) *BroadcastOperator {
 	return n.newBroadcastOperator().Except(room...)
 }
 
-// Compression flag is unused at the moment, thus setting this will have no effect on compression.
+// Sets a modifier for a subsequent event emission that the event data will
+// only be compressed if the value is true (only applies to the websocket transport with permessage-deflate
+// enabled, and to the polling transport with HTTP compression enabled).
 func (n *Namespace) Compress(compress bool) *BroadcastOperator {
 	return n.newBroadcastOperator().Compress(compress)
 }
@@ -179,8 +181,9 @@ func (n *Namespace) add(c *serverConn, auth json.RawMessage) (*serverSocket, err
 
 	var (
 		handshake = &Handshake{
-			Time: time.Now(),
-			Auth: auth,
+			Time:      time.Now(),
+			Auth:      auth,
+			Handshake: c.eio.Handshake(),
 		}
 		authRecoveryFields authRecoveryFields
 		socket             *serverSocket
@@ -215,6 +218,8 @@ func (n *Namespace) add(c *serverConn, auth json.RawMessage) (*serverSocket, err
 		}
 	}
 
+	socket.handshake = handshake
+
 	if n.server.connectionStateRecovery.Enabled && !n.server.connectionStateRecovery.UseMiddlewares && socket.Recovered() {
 		return socket, n.doConnect(socket)
 	}
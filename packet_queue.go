@@ -1,6 +1,7 @@
 package sio
 
 import (
+	"context"
 	"time"
 
 	"github.com/tomruk/socket.io-go/internal/sync"
@@ -99,20 +100,27 @@ func (pq *packetQueue) close() {
 }
 
 func (pq *packetQueue) waitForDrain(timeout time.Duration) (timedout bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return !pq.waitForDrainContext(ctx)
+}
+
+// Same as waitForDrain, except that it waits until ctx is done.
+func (pq *packetQueue) waitForDrainContext(ctx context.Context) (drained bool) {
 	pq.mu.Lock()
 	alreadyDrained := len(pq.packets) == 0
 	pq.mu.Unlock()
 	if alreadyDrained {
-		return
+		return true
 	}
 
 	select {
 	case <-pq.drain:
 	case <-pq._reset:
-	case <-time.After(timeout):
-		timedout = true
+	case <-ctx.Done():
+		return false
 	}
-	return
+	return true
 }
 
 func (pq *packetQueue) pollAndSend(socket eio.Socket) {
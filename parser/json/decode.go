@@ -6,6 +6,7 @@ import (
 
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/tomruk/socket.io-go/parser"
 )
@@ -105,7 +106,15 @@ func (p *Parser) parseHeader(data []byte) (header *parser.PacketHeader, buf []by
 		}
 
 		header.Namespace = string(data[:i])
-		data = data[i+1:]
+		if p.protocolVersion == parser.ProtocolVersion4 {
+			header.Namespace, _, _ = strings.Cut(header.Namespace, "?")
+		}
+
+		if i < len(data) {
+			data = data[i+1:]
+		} else {
+			data = data[i:]
+		}
 	} else {
 		header.Namespace = "/"
 	}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/tomruk/socket.io-go/parser"
 	"github.com/tomruk/socket.io-go/parser/json/serializer/stdjson"
 )
@@ -49,6 +50,28 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestDecodeV4(t *testing.T) {
+	c := NewCreatorV4(0, stdjson.New())
+	p := c()
+
+	tests := map[string]string{
+		"0/admin,":           "/admin",
+		"0/admin?token=abc,": "/admin",
+		"0/admin?token=abc":  "/admin",
+		"0":                  "/",
+	}
+	for buf, expectedNamespace := range tests {
+		finishHappened := false
+		err := p.Add([]byte(buf), func(header *parser.PacketHeader, eventName string, decode parser.Decode) {
+			finishHappened = true
+			require.Equal(t, parser.PacketTypeConnect, header.Type)
+			require.Equal(t, expectedNamespace, header.Namespace, "buf: %s", buf)
+		})
+		require.NoError(t, err)
+		require.True(t, finishHappened, "finish callback didn't run")
+	}
+}
+
 func TestMaxAttachmentsDecode(t *testing.T) {
 	c := NewCreator(0, stdjson.New())
 	p := c()
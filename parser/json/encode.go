@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strconv"
 
+	"github.com/tomruk/socket.io-go/internal/bufpool"
 	"github.com/tomruk/socket.io-go/parser"
 )
 
@@ -26,7 +27,7 @@ type _empty struct{}
 var empty _empty
 
 func (p *Parser) Encode(header *parser.PacketHeader, v any) ([][]byte, error) {
-	if v == nil {
+	if v == nil || (p.protocolVersion == parser.ProtocolVersion4 && header.Type == parser.PacketTypeConnect) {
 		v = &empty
 	}
 
@@ -60,9 +61,13 @@ func (p *Parser) Encode(header *parser.PacketHeader, v any) ([][]byte, error) {
 }
 
 func (p *Parser) encodeString(header *parser.PacketHeader, v any) ([]byte, error) {
+	// The pooled buffer saves the allocations of growing a new buffer for every packet.
+	// The encoded packet is owned by the caller, so it is copied out into one exact-sized slice.
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+
 	var (
-		buf  = bytes.Buffer{}
-		e    = p.json.NewEncoder(&buf)
+		e    = p.json.NewEncoder(buf)
 		grow int
 	)
 
@@ -100,10 +105,10 @@ func (p *Parser) encodeString(header *parser.PacketHeader, v any) ([]byte, error
 		if len(b) != 0 && b[len(b)-1] == '\n' {
 			b = b[:len(b)-1]
 		}
-		return b, nil
+		return bytes.Clone(b), nil
 	}
 
-	return buf.Bytes(), nil
+	return bytes.Clone(buf.Bytes()), nil
 }
 
 func (p *Parser) encodeBinary(header *parser.PacketHeader, v any) (buffers [][]byte, err error) {
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/cristalhq/jsn"
+	"github.com/stretchr/testify/require"
 	"github.com/tomruk/socket.io-go/parser"
 	"github.com/tomruk/socket.io-go/parser/json/serializer/stdjson"
 )
@@ -54,6 +55,26 @@ func TestEncode(t *testing.T) {
 	}
 }
 
+func TestEncodeV4(t *testing.T) {
+	c := NewCreatorV4(0, stdjson.New())
+	p := c()
+
+	// CONNECT packets don't have a payload in protocol v4.
+	buffers, err := p.Encode(&parser.PacketHeader{Type: parser.PacketTypeConnect, Namespace: "/admin"}, &struct {
+		SID string `json:"sid"`
+	}{SID: "123"})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("0/admin,")}, buffers)
+
+	buffers, err = p.Encode(&parser.PacketHeader{Type: parser.PacketTypeConnect, Namespace: "/"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("0")}, buffers)
+
+	buffers, err = p.Encode(&parser.PacketHeader{Type: parser.PacketTypeEvent, Namespace: "/"}, &[]any{"hello", "world"})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(`2["hello","world"]`)}, buffers)
+}
+
 func TestMaxAttachmentsEncode(t *testing.T) {
 	c := NewCreator(3, stdjson.New())
 	p := c()
@@ -244,3 +265,18 @@ func mustCreatePacketHeader(_ *testing.T, packetType parser.PacketType, namespac
 		ID:        ackIDPtr,
 	}
 }
+
+func BenchmarkEncode(b *testing.B) {
+	p := NewCreator(0, stdjson.New())()
+	v := []any{"message", map[string]any{"text": "hello", "count": 123}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		header := &parser.PacketHeader{Type: parser.PacketTypeEvent, Namespace: "/chat"}
+		_, err := p.Encode(header, &v)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
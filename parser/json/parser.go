@@ -15,16 +15,36 @@ func NewCreator(maxAttachments int, json serializer.JSONSerializer) parser.Creat
 	}
 	return func() parser.Parser {
 		return &Parser{
-			maxAttachments: maxAttachments,
-			json:           json,
+			protocolVersion: parser.ProtocolVersion,
+			maxAttachments:  maxAttachments,
+			json:            json,
+		}
+	}
+}
+
+// Same as NewCreator, but the parsers created use the Socket.IO protocol v4 (Socket.IO v2 clients).
+//
+// Differences from the protocol v5:
+//   - CONNECT packets are encoded without a payload (there is no session ID).
+//   - The query string of the namespace in CONNECT packets (`/admin?token=abc`) is discarded.
+func NewCreatorV4(maxAttachments int, json serializer.JSONSerializer) parser.Creator {
+	if json == nil {
+		panic(fmt.Errorf("sio: jsonparser.NewCreatorV4: `json` must be set"))
+	}
+	return func() parser.Parser {
+		return &Parser{
+			protocolVersion: parser.ProtocolVersion4,
+			maxAttachments:  maxAttachments,
+			json:            json,
 		}
 	}
 }
 
 type Parser struct {
-	r              *reconstructor
-	maxAttachments int
-	json           serializer.JSONSerializer
+	r               *reconstructor
+	protocolVersion int
+	maxAttachments  int
+	json            serializer.JSONSerializer
 }
 
 func (p *Parser) Reset() {
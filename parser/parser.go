@@ -4,6 +4,9 @@ import "reflect"
 
 const ProtocolVersion = 5
 
+// Socket.IO protocol v4. This is used by the Socket.IO v2 clients.
+const ProtocolVersion4 = 4
+
 type (
 	Creator func() Parser
 	Finish  func(header *PacketHeader, eventName string, decode Decode)
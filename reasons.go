@@ -21,7 +21,7 @@ const (
 )
 
 const (
-	ReasonServerShuttingDown        Reason = "server shutting down"
+	ReasonServerShuttingDown        Reason = eio.ReasonServerShuttingDown
 	ReasonForcedServerClose         Reason = "forced server close"
 	ReasonClientNamespaceDisconnect Reason = "client namespace disconnect"
 	ReasonServerNamespaceDisconnect Reason = "server namespace disconnect"
@@ -1,11 +1,13 @@
 package sio
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/tomruk/socket.io-go/adapter"
 	eio "github.com/tomruk/socket.io-go/engine.io"
+	"github.com/tomruk/socket.io-go/internal/sync"
 	"github.com/tomruk/socket.io-go/parser"
 	jsonparser "github.com/tomruk/socket.io-go/parser/json"
 	"github.com/tomruk/socket.io-go/parser/json/serializer/stdjson"
@@ -19,9 +21,18 @@ const (
 type BroadcastOperator = adapter.BroadcastOperator
 
 type (
+	// Generate an ID for a socket connecting to the namespace.
+	// eioSocket is the underlying Engine.IO connection of the socket.
+	ServerIDGeneratorFunc func(namespace string, eioSocket eio.ServerSocket) (id SocketID, err error)
+
 	ServerConfig struct {
 		// For custom parsers
 		ParserCreator parser.Creator
+		// Parser for the Socket.IO v2 clients (Socket.IO protocol v4).
+		// This is only used if EIO.AllowEIO3 is set.
+		//
+		// Default: jsonparser.NewCreatorV4
+		ParserCreatorV4 parser.Creator
 		// For custom adapters
 		AdapterCreator adapter.Creator
 
@@ -44,6 +55,14 @@ type (
 
 		ServerConnectionStateRecovery ServerConnectionStateRecovery
 
+		// Custom socket ID generator. Socket IDs must be unique across the server
+		// (and across the cluster if an adapter other than the in-memory adapter is used).
+		//
+		// For the Engine.IO session IDs, use EIO.IDGenerator.
+		//
+		// Default: eio.GenerateBase64ID(eio.Base64IDSize)
+		IDGenerator ServerIDGeneratorFunc
+
 		// For debugging purposes. Leave it nil if it is of no use.
 		//
 		// This only applies to Socket.IO. For Engine.IO, use EIO.Debugger.
@@ -68,8 +87,9 @@ type (
 	}
 
 	Server struct {
-		parserCreator  parser.Creator
-		adapterCreator adapter.Creator
+		parserCreator   parser.Creator
+		parserCreatorV4 parser.Creator
+		adapterCreator  adapter.Creator
 
 		eio        *eio.Server
 		namespaces *nspStore
@@ -79,6 +99,8 @@ type (
 
 		connectionStateRecovery ServerConnectionStateRecovery
 
+		idGenerator ServerIDGeneratorFunc
+
 		debug Debugger
 
 		newNamespaceHandlers  *handlerStore[*ServerNewNamespaceFunc]
@@ -93,10 +115,12 @@ func NewServer(config *ServerConfig) *Server {
 
 	server := &Server{
 		parserCreator:           config.ParserCreator,
+		parserCreatorV4:         config.ParserCreatorV4,
 		adapterCreator:          config.AdapterCreator,
 		namespaces:              newNspStore(),
 		acceptAnyNamespace:      config.AcceptAnyNamespace,
 		connectionStateRecovery: config.ServerConnectionStateRecovery,
+		idGenerator:             config.IDGenerator,
 		newNamespaceHandlers:    newHandlerStore[*ServerNewNamespaceFunc](),
 		anyConnectionHandlers:   newHandlerStore[*ServerAnyConnectionFunc](),
 	}
@@ -120,11 +144,22 @@ func NewServer(config *ServerConfig) *Server {
 		json := stdjson.New()
 		server.parserCreator = jsonparser.NewCreator(0, json)
 	}
+	if server.parserCreatorV4 == nil {
+		json := stdjson.New()
+		server.parserCreatorV4 = jsonparser.NewCreatorV4(0, json)
+	}
 
 	if server.adapterCreator == nil {
 		server.adapterCreator = adapter.NewInMemoryAdapterCreator()
 	}
 
+	if server.idGenerator == nil {
+		server.idGenerator = func(namespace string, eioSocket eio.ServerSocket) (id SocketID, err error) {
+			_id, err := eio.GenerateBase64ID(eio.Base64IDSize)
+			return SocketID(_id), err
+		}
+	}
+
 	if config.ConnectTimeout != 0 {
 		server.connectTimeout = config.ConnectTimeout
 	} else {
@@ -135,7 +170,11 @@ func NewServer(config *ServerConfig) *Server {
 }
 
 func (s *Server) onEIOSocket(eioSocket eio.ServerSocket) *eio.Callbacks {
-	_, callbacks := newServerConn(s, eioSocket, s.parserCreator)
+	creator := s.parserCreator
+	if eioSocket.ProtocolVersion() == eio.ProtocolVersion3 {
+		creator = s.parserCreatorV4
+	}
+	_, callbacks := newServerConn(s, eioSocket, creator)
 	return callbacks
 }
 
@@ -200,7 +239,9 @@ func (s *Server) Except(room ...Room) *BroadcastOperator {
 	return s.Of("/").Except(room...)
 }
 
-// Compression flag is unused at the moment, thus setting this will have no effect on compression.
+// Sets a modifier for a subsequent event emission that the event data will
+// only be compressed if the value is true (only applies to the websocket transport with permessage-deflate
+// enabled, and to the polling transport with HTTP compression enabled).
 //
 // Alias of: s.Of("/").Compress(...)
 func (s *Server) Compress(compress bool) *BroadcastOperator {
@@ -280,6 +321,40 @@ func (s *Server) IsClosed() bool {
 	return s.eio.IsClosed()
 }
 
+// Gracefully shut down the server. Server cannot be restarted once it is shut down.
+//
+// New connections are rejected. Then each connection is shut down after a random delay
+// within EIO.ShutdownJitter (see: eio.ServerConfig.ShutdownJitter): the server waits for the pending acknowledgements
+// of its sockets to be received, sends a DISCONNECT packet to every socket, and waits for the queued packets to be sent.
+// Then the Engine.IO connection is closed (see: eio.Server.Shutdown).
+// Sockets are disconnected with ReasonServerShuttingDown. Since the clients receive a DISCONNECT packet,
+// their sockets are disconnected with ReasonIOServerDisconnect and they don't reconnect automatically.
+//
+// If ctx is done before the shutdown is complete, the remaining connections are closed immediately and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.debug.Log("Shutting down")
+	var (
+		connsOnce sync.Once
+		conns     map[string]*serverConn
+	)
+	return s.eio.ShutdownWithHook(ctx, func(ctx context.Context, eioSocket eio.ServerSocket) {
+		// The connections are collected once new connections are rejected.
+		connsOnce.Do(func() {
+			conns = make(map[string]*serverConn)
+			for _, nsp := range s.namespaces.getAll() {
+				for _, socket := range nsp.Sockets() {
+					conn := socket.(*serverSocket).conn
+					conns[conn.eio.ID()] = conn
+				}
+			}
+		})
+		conn, ok := conns[eioSocket.ID()]
+		if ok {
+			conn.shutdown(ctx)
+		}
+	})
+}
+
 // Shut down the server. Server cannot be restarted once it is closed.
 func (s *Server) Close() error {
 	for _, _socket := range s.Sockets() {
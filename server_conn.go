@@ -1,6 +1,7 @@
 package sio
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -60,6 +61,16 @@ func newServerConn(
 
 	go c.eioPacketQueue.pollAndSend(c.eio)
 
+	// Socket.IO v2 clients don't send a CONNECT packet for the main namespace.
+	// They are connected to it implicitly.
+	if _eio.ProtocolVersion() == eio.ProtocolVersion3 {
+		header := &parser.PacketHeader{
+			Type:      parser.PacketTypeConnect,
+			Namespace: "/",
+		}
+		go c.connect(header, noAuth)
+	}
+
 	go func() {
 		time.Sleep(server.connectTimeout)
 		if c.nsps.len() == 0 {
@@ -157,9 +168,29 @@ func (c *serverConn) connect(header *parser.PacketHeader, decode parser.Decode)
 	c.nsps.set(nsp)
 }
 
+// Decode function of a CONNECT packet without an auth payload.
+// Like the parser does for such a packet, an empty object is decoded into each of the types.
+func noAuth(types ...reflect.Type) (values []reflect.Value, err error) {
+	values = make([]reflect.Value, len(types))
+	for i, t := range types {
+		rv := reflect.New(t)
+		err = json.Unmarshal([]byte("{}"), rv.Interface())
+		if err != nil {
+			return nil, err
+		}
+		values[i] = rv.Elem()
+	}
+	return
+}
+
 func (c *serverConn) connectError(err error, nsp string) {
-	e := &connectError{
-		Message: err.Error(),
+	message := err.Error()
+	var v any = &ConnectError{
+		Message: message,
+	}
+	// Socket.IO v2 clients expect the error message as a plain string.
+	if c.eio.ProtocolVersion() == eio.ProtocolVersion3 {
+		v = &message
 	}
 
 	header := parser.PacketHeader{
@@ -167,38 +198,43 @@ func (c *serverConn) connectError(err error, nsp string) {
 		Namespace: nsp,
 	}
 
-	buffers, err := c.parser.Encode(&header, e)
+	buffers, err := c.parser.Encode(&header, v)
 	if err != nil {
 		c.onFatalError(wrapInternalError(err))
 		return
 	}
 
-	c.sendBuffers(buffers...)
+	c.sendBuffers(true, buffers...)
 }
 
-func (c *serverConn) sendBuffers(buffers ...[]byte) {
-	if len(buffers) > 0 {
-		packets := make([]*eioparser.Packet, len(buffers))
-		buf := buffers[0]
-		buffers = buffers[1:]
+// If compress is false, the packets will be sent without compression.
+func (c *serverConn) sendBuffers(compress bool, buffers ...[]byte) {
+	packets, err := newEIOPackets(compress, buffers...)
+	if err != nil {
+		c.onFatalError(wrapInternalError(err))
+		return
+	}
+	if len(packets) > 0 {
+		c.packet(packets...)
+	}
+}
 
-		var err error
-		packets[0], err = eioparser.NewPacket(eioparser.PacketTypeMessage, false, buf)
+// Create the Engine.IO packets of an encoded Socket.IO packet.
+// The first buffer is the packet itself and the rest are its binary attachments.
+func newEIOPackets(compress bool, buffers ...[]byte) ([]*eioparser.Packet, error) {
+	if len(buffers) == 0 {
+		return nil, nil
+	}
+	packets := make([]*eioparser.Packet, len(buffers))
+	for i, buf := range buffers {
+		packet, err := eioparser.NewPacket(eioparser.PacketTypeMessage, i > 0, buf)
 		if err != nil {
-			c.onFatalError(wrapInternalError(err))
-			return
-		}
-
-		for i, attachment := range buffers {
-			packets[i+1], err = eioparser.NewPacket(eioparser.PacketTypeMessage, true, attachment)
-			if err != nil {
-				c.onFatalError(wrapInternalError(err))
-				return
-			}
+			return nil, err
 		}
-
-		c.packet(packets...)
+		packet.SkipCompression = !compress
+		packets[i] = packet
 	}
+	return packets, nil
 }
 
 func (c *serverConn) packet(packets ...*eioparser.Packet) {
@@ -252,6 +288,25 @@ func (c *serverConn) disconnectAll() {
 	}
 }
 
+// Wait until the queued packets are handed over to Engine.IO, or until ctx is done.
+func (c *serverConn) waitForDrain(ctx context.Context) {
+	c.eioPacketQueue.waitForDrainContext(ctx)
+}
+
+// Shut down the sockets of the connection (see: serverSocket.shutdown) and wait for the queued packets to be sent.
+func (c *serverConn) shutdown(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, socket := range c.sockets.getAll() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			socket.shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	c.waitForDrain(ctx)
+}
+
 func (c *serverConn) closePacketQueue() {
 	go func() {
 		c.eioPacketQueue.waitForDrain(2 * time.Minute)
@@ -1,6 +1,7 @@
 package sio
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"time"
@@ -17,6 +18,7 @@ type serverSocket struct {
 	id        SocketID
 	pid       adapter.PrivateSessionID
 	recovered bool
+	handshake *Handshake
 
 	// `connected` means "did we receive the CONNECT packet?"
 	connected   bool
@@ -31,6 +33,9 @@ type serverSocket struct {
 
 	acks   map[uint64]*ackHandler
 	acksMu sync.Mutex
+	// Closed when there are no pending acknowledgements.
+	// It is replaced with a new channel when an acknowledgement is registered.
+	acksDone chan struct{}
 
 	middlewareFuncs   []reflect.Value
 	middlewareFuncsMu sync.RWMutex
@@ -57,18 +62,21 @@ func newServerSocket(
 ) (*serverSocket, error) {
 	_adapter := nsp.Adapter()
 	s := &serverSocket{
-		server:  server,
-		conn:    c,
-		nsp:     nsp,
-		adapter: _adapter,
-		parser:  parser,
-		acks:    make(map[uint64]*ackHandler),
+		server:   server,
+		conn:     c,
+		nsp:      nsp,
+		adapter:  _adapter,
+		parser:   parser,
+		acks:     make(map[uint64]*ackHandler),
+		acksDone: make(chan struct{}),
 
 		eventHandlers:         newEventHandlerStore(),
 		errorHandlers:         newHandlerStore[*ServerSocketErrorFunc](),
 		disconnectingHandlers: newHandlerStore[*ServerSocketDisconnectingFunc](),
 		disconnectHandlers:    newHandlerStore[*ServerSocketDisconnectFunc](),
 	}
+	// There are no pending acknowledgements yet.
+	close(s.acksDone)
 
 	s.join = func(room ...Room) {
 		s.debug.Log("Joining room(s)", room)
@@ -85,14 +93,14 @@ func newServerSocket(
 			if err != nil {
 				return nil, err
 			}
-			s.conn.sendBuffers(buffers...)
+			s.conn.sendBuffers(missedPacket.Opts.Flags.Compress, buffers...)
 		}
 	} else {
-		id, err := eio.GenerateBase64ID(eio.Base64IDSize)
+		id, err := server.idGenerator(nsp.Name(), c.eio)
 		if err != nil {
 			return nil, err
 		}
-		s.id = SocketID(id)
+		s.id = id
 		s.recovered = false
 
 		if server.connectionStateRecovery.Enabled {
@@ -112,6 +120,10 @@ func (s *serverSocket) Server() *Server { return s.server }
 
 func (s *serverSocket) Namespace() *Namespace { return s.nsp }
 
+func (s *serverSocket) Stats() eio.SocketStats { return s.conn.eio.Stats() }
+
+func (s *serverSocket) Handshake() *Handshake { return s.handshake }
+
 func (s *serverSocket) Recovered() bool { return s.recovered }
 
 func (s *serverSocket) Connected() bool {
@@ -253,7 +265,7 @@ func (s *serverSocket) onAck(header *parser.PacketHeader, decode parser.Decode)
 	s.acksMu.Lock()
 	ack, ok := s.acks[*header.ID]
 	if ok {
-		delete(s.acks, *header.ID)
+		s.deleteAck(*header.ID)
 	}
 	s.acksMu.Unlock()
 
@@ -357,6 +369,28 @@ func (s *serverSocket) onError(err error) {
 	s.errorHandlers.forEach(func(handler *ServerSocketErrorFunc) { (*handler)(err) }, true)
 }
 
+// Wait until all pending acknowledgements are received (or timed out), or until ctx is done.
+func (s *serverSocket) waitForAcks(ctx context.Context) {
+	s.acksMu.Lock()
+	done := s.acksDone
+	s.acksMu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// Wait for the pending acknowledgements, then send a DISCONNECT packet and close the socket.
+func (s *serverSocket) shutdown(ctx context.Context) {
+	s.waitForAcks(ctx)
+	if !s.Connected() {
+		return
+	}
+	s.sendControlPacket(parser.PacketTypeDisconnect, nil)
+	s.onClose(ReasonServerShuttingDown)
+}
+
 func (s *serverSocket) onClose(reason Reason) {
 	s.debug.Log("Going to close the socket if it is not already closed. Reason", reason)
 
@@ -409,13 +443,13 @@ func (s *serverSocket) ID() SocketID {
 }
 
 func (s *serverSocket) Emit(eventName string, v ...any) {
-	s.emit(eventName, 0, false, false, v...)
+	s.emit(eventName, 0, false, true, false, v...)
 }
 
 func (s *serverSocket) emit(
 	eventName string,
 	timeout time.Duration,
-	volatile, fromQueue bool,
+	volatile, compress, fromQueue bool,
 	_v ...any) {
 	header := &parser.PacketHeader{
 		Type:      parser.PacketTypeEvent,
@@ -444,6 +478,7 @@ func (s *serverSocket) emit(
 	if s.server.connectionStateRecovery.Enabled {
 		opts := adapter.NewBroadcastOptions()
 		opts.Rooms.Add(Room(s.id))
+		opts.Flags.Compress = compress
 		s.adapter.Broadcast(header, v, opts)
 	} else {
 		buffers, err := s.parser.Encode(header, &v)
@@ -451,7 +486,7 @@ func (s *serverSocket) emit(
 			s.onError(wrapInternalError(err))
 			return
 		}
-		s.conn.sendBuffers(buffers...)
+		s.conn.sendBuffers(compress, buffers...)
 	}
 }
 
@@ -465,7 +500,7 @@ func (s *serverSocket) registerAckHandler(f any, timeout time.Duration) (id uint
 		if err != nil {
 			panic(err)
 		}
-		s.acks[id] = h
+		s.setAck(id, h)
 		s.acksMu.Unlock()
 		return
 	}
@@ -473,7 +508,7 @@ func (s *serverSocket) registerAckHandler(f any, timeout time.Duration) (id uint
 	h, err := newAckHandlerWithTimeout(f, timeout, func() {
 		s.debug.Log("Timeout occured for ack with ID", id, "timeout", timeout)
 		s.acksMu.Lock()
-		delete(s.acks, id)
+		s.deleteAck(id)
 		s.acksMu.Unlock()
 	})
 	if err != nil {
@@ -481,11 +516,30 @@ func (s *serverSocket) registerAckHandler(f any, timeout time.Duration) (id uint
 	}
 
 	s.acksMu.Lock()
-	s.acks[id] = h
+	s.setAck(id, h)
 	s.acksMu.Unlock()
 	return
 }
 
+// acksMu must be locked.
+func (s *serverSocket) setAck(id uint64, h *ackHandler) {
+	if len(s.acks) == 0 {
+		s.acksDone = make(chan struct{})
+	}
+	s.acks[id] = h
+}
+
+// acksMu must be locked.
+func (s *serverSocket) deleteAck(id uint64) {
+	if _, ok := s.acks[id]; !ok {
+		return
+	}
+	delete(s.acks, id)
+	if len(s.acks) == 0 {
+		close(s.acksDone)
+	}
+}
+
 func (s *serverSocket) Timeout(timeout time.Duration) Emitter {
 	return Emitter{
 		socket:  s,
@@ -493,6 +547,13 @@ func (s *serverSocket) Timeout(timeout time.Duration) Emitter {
 	}
 }
 
+func (s *serverSocket) Compress(compress bool) Emitter {
+	return Emitter{
+		socket:     s,
+		noCompress: !compress,
+	}
+}
+
 func (s *serverSocket) sendControlPacket(typ parser.PacketType, v any) {
 	header := parser.PacketHeader{
 		Type:      typ,
@@ -509,7 +570,7 @@ func (s *serverSocket) sendControlPacket(typ parser.PacketType, v any) {
 		s.onError(wrapInternalError(err))
 		return
 	}
-	s.conn.sendBuffers(buffers...)
+	s.conn.sendBuffers(true, buffers...)
 }
 
 func (s *serverSocket) sendAckPacket(id uint64, values []reflect.Value) {
@@ -536,7 +597,7 @@ func (s *serverSocket) sendAckPacket(id uint64, values []reflect.Value) {
 		return
 	}
 
-	s.conn.sendBuffers(buffers...)
+	s.conn.sendBuffers(true, buffers...)
 }
 
 func (s *serverSocket) Disconnect(close bool) {
@@ -1,12 +1,26 @@
 package sio
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	eio "github.com/tomruk/socket.io-go/engine.io"
+	eioparser "github.com/tomruk/socket.io-go/engine.io/parser"
+	"github.com/tomruk/socket.io-go/engine.io/transport"
+	"github.com/tomruk/socket.io-go/engine.io/transport/memory"
+	"github.com/tomruk/socket.io-go/internal/sync"
 	"nhooyr.io/websocket"
 )
 
@@ -111,6 +125,365 @@ func TestServer(t *testing.T) {
 		})
 		tw.WaitTimeout(t, defaultTestWaitTimeout)
 	})
+
+	t.Run("should emit with and without compression", func(t *testing.T) {
+		perMessageDeflate := &eio.PerMessageDeflateConfig{Threshold: 2}
+		// Record what the client receives, to check which messages are compressed.
+		received := new(recordingConn)
+		server, _, manager := newTestServerAndClient(
+			t,
+			&ServerConfig{EIO: eio.ServerConfig{PerMessageDeflate: perMessageDeflate}},
+			&ManagerConfig{EIO: eio.ClientConfig{
+				Transports:        []string{"websocket"},
+				PerMessageDeflate: perMessageDeflate,
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					conn, err := new(net.Dialer).DialContext(ctx, network, addr)
+					received.Conn = conn
+					return received, err
+				},
+			}},
+		)
+		socket := manager.Socket("/", nil)
+		tw := newTestWaiter(4)
+
+		socket.OnEvent("compressed", func(message string) {
+			assert.Equal(t, "hello", message)
+			tw.Done()
+		})
+		socket.OnEvent("uncompressed", func(message string) {
+			assert.Equal(t, "hello", message)
+			tw.Done()
+		})
+
+		server.OnConnection(func(socket ServerSocket) {
+			socket.OnEvent("compressed", func(message string) {
+				assert.Equal(t, "hi", message)
+				tw.Done()
+			})
+			socket.OnEvent("uncompressed", func(message string) {
+				assert.Equal(t, "hi", message)
+				tw.Done()
+			})
+			compressed, uncompressed := socket.Compress(true), socket.Compress(false)
+			compressed.Emit("compressed", "hello")
+			uncompressed.Emit("uncompressed", "hello")
+		})
+		socket.OnConnect(func() {
+			compressed, uncompressed := socket.Compress(true), socket.Compress(false)
+			compressed.Emit("compressed", "hi")
+			uncompressed.Emit("uncompressed", "hi")
+		})
+		socket.Connect()
+
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+		var (
+			compressed   int
+			uncompressed []string
+		)
+		for _, message := range readWebSocketMessages(t, received.Bytes()) {
+			if message.compressed {
+				compressed++
+			} else {
+				uncompressed = append(uncompressed, string(message.data))
+			}
+		}
+		assert.Contains(t, uncompressed, `42["uncompressed","hello"]`)
+		assert.NotContains(t, uncompressed, `42["compressed","hello"]`)
+		assert.NotZero(t, compressed)
+	})
+
+	t.Run("should use `IDGenerator` and `EIO.IDGenerator`", func(t *testing.T) {
+		server, _, manager := newTestServerAndClient(
+			t,
+			&ServerConfig{
+				IDGenerator: func(namespace string, eioSocket eio.ServerSocket) (id SocketID, err error) {
+					return SocketID(eioSocket.ID() + namespace), nil
+				},
+				EIO: eio.ServerConfig{
+					IDGenerator: func(r *http.Request) (sid string, err error) {
+						return "node1", nil
+					},
+				},
+			},
+			nil,
+		)
+		tw := newTestWaiterString()
+		tw.Add("/")
+		tw.Add("/chat")
+
+		server.OnConnection(func(socket ServerSocket) {
+			defer tw.Done("/")
+			assert.Equal(t, SocketID("node1/"), socket.ID())
+		})
+		server.Of("/chat").OnConnection(func(socket ServerSocket) {
+			defer tw.Done("/chat")
+			assert.Equal(t, SocketID("node1/chat"), socket.ID())
+		})
+		manager.Socket("/", nil).Connect()
+		manager.Socket("/chat", nil).Connect()
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
+
+	t.Run("handshake should be passed to middlewares and exposed by `ServerSocket`", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("Cookie", "token=abc")
+		server, _, manager := newTestServerAndClient(
+			t,
+			nil,
+			&ManagerConfig{EIO: eio.ClientConfig{RequestHeader: transport.NewRequestHeader(header)}},
+		)
+		socket := manager.Socket("/", &ClientSocketConfig{Auth: map[string]string{"name": "bob"}})
+		tw := newTestWaiter(2)
+
+		server.Use(func(socket ServerSocket, handshake *Handshake) error {
+			defer tw.Done()
+			cookie, err := handshake.Cookie("token")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "abc", cookie.Value)
+			}
+			assert.Equal(t, "127.0.0.1", handshake.Address)
+			assert.Equal(t, strconv.Itoa(eio.ProtocolVersion), handshake.Query.Get("EIO"))
+			assert.False(t, handshake.Secure)
+			assert.JSONEq(t, `{"name":"bob"}`, string(handshake.Auth))
+			return nil
+		})
+		server.OnConnection(func(socket ServerSocket) {
+			defer tw.Done()
+			handshake := socket.Handshake()
+			assert.Equal(t, "127.0.0.1", handshake.Address)
+			assert.Equal(t, "token=abc", handshake.Headers.Get("Cookie"))
+		})
+		socket.Connect()
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
+
+	t.Run("transport statistics should be exposed by `ServerSocket` and `Manager`", func(t *testing.T) {
+		server, _, manager := newTestServerAndClient(t, nil, nil)
+		socket := manager.Socket("/", nil)
+		tw := newTestWaiter(1)
+
+		_, ok := manager.Stats()
+		require.False(t, ok, "manager is not connected yet")
+
+		server.OnConnection(func(socket ServerSocket) {
+			socket.OnEvent("hello", func() {
+				stats := socket.Stats()
+				assert.NotEmpty(t, stats.TransportName)
+				assert.Greater(t, stats.PacketsReceived, uint64(0))
+				assert.Greater(t, stats.BytesReceived, uint64(0))
+				tw.Done()
+			})
+		})
+		socket.OnConnect(func() {
+			socket.Emit("hello")
+		})
+		socket.Connect()
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+
+		stats, ok := manager.Stats()
+		require.True(t, ok)
+		require.NotEmpty(t, stats.TransportName)
+		require.Greater(t, stats.PacketsSent, uint64(0))
+		require.Greater(t, stats.BytesSent, uint64(0))
+	})
+
+	t.Run("should serve Socket.IO v2 clients if `EIO.AllowEIO3` is set", func(t *testing.T) {
+		server, httpServer, _ := newTestServerAndClient(
+			t,
+			&ServerConfig{EIO: eio.ServerConfig{AllowEIO3: true}},
+			nil,
+		)
+		tw := newTestWaiterString()
+		tw.Add("/")
+		tw.Add("hello")
+		tw.Add("/admin")
+
+		server.OnConnection(func(socket ServerSocket) {
+			socket.OnEvent("hello", func(message string) {
+				assert.Equal(t, "world", message)
+				tw.Done("hello")
+			})
+			tw.Done("/")
+		})
+		server.Of("/admin").OnConnection(func(socket ServerSocket) {
+			tw.Done("/admin")
+		})
+
+		url := httpServer.URL + "/socket.io/?EIO=3&transport=polling"
+		poll := func() []*eioparser.Packet {
+			resp, err := http.Get(url)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			packets, err := eioparser.DecodePayloadsV3(resp.Body, false)
+			require.NoError(t, err)
+			return packets
+		}
+		send := func(payload string) {
+			resp, err := http.Post(url, "text/plain;charset=UTF-8", strings.NewReader(payload))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+
+		packets := poll()
+		hr, err := eioparser.ParseHandshakeResponse(packets[0])
+		require.NoError(t, err)
+		url += "&sid=" + hr.SID
+
+		// The client is connected to the main namespace without sending a CONNECT packet.
+		if len(packets) == 1 {
+			packets = poll()
+		} else {
+			packets = packets[1:]
+		}
+		require.Equal(t, "0", string(packets[0].Data))
+
+		send(`19:42["hello","world"]`)
+		send("13:40/admin?a=b,")
+		packets = poll()
+		require.Equal(t, "0/admin,", string(packets[0].Data))
+
+		// CONNECT_ERROR is sent with a plain string payload.
+		send("11:40/unknown,")
+		packets = poll()
+		require.Equal(t, `4/unknown,"namespace '/unknown' was not created and AcceptAnyNamespace was not set"`, string(packets[0].Data))
+
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
+
+	t.Run("`Shutdown` should wait for pending acks", func(t *testing.T) {
+		server, _, manager := newTestServerAndClient(
+			t,
+			nil,
+			&ManagerConfig{NoReconnection: true},
+		)
+		socket := manager.Socket("/", nil)
+		tw := newTestWaiter(2)
+		connected := newTestWaiter(1)
+
+		socket.OnEvent("ack", func(message string, ack func(reply string)) {
+			// Reply after Shutdown is called.
+			time.Sleep(100 * time.Millisecond)
+			ack("hi")
+		})
+
+		server.OnConnection(func(socket ServerSocket) {
+			socket.OnDisconnect(func(reason Reason) {
+				defer tw.Done()
+				assert.Equal(t, ReasonServerShuttingDown, reason)
+			})
+			socket.Emit("ack", "hello", func(reply string) {
+				defer tw.Done()
+				assert.Equal(t, "hi", reply)
+			})
+			connected.Done()
+		})
+		socket.Connect()
+		connected.WaitTimeout(t, defaultTestWaitTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTestWaitTimeout)
+		defer cancel()
+		err := server.Shutdown(ctx)
+		require.NoError(t, err)
+		require.True(t, server.IsClosed())
+
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
+
+	t.Run("`Shutdown` should send a DISCONNECT packet to the sockets of every namespace", func(t *testing.T) {
+		server, _, manager := newTestServerAndClient(
+			t,
+			nil,
+			&ManagerConfig{NoReconnection: true},
+		)
+		tw := newTestWaiterString()
+		tw.Add("/")
+		tw.Add("/chat")
+		connected := newTestWaiter(2)
+
+		for _, name := range []string{"/", "/chat"} {
+			server.Of(name)
+			socket := manager.Socket(name, nil)
+			socket.OnConnect(func() { connected.Done() })
+			socket.OnDisconnect(func(reason Reason) {
+				defer tw.Done(name)
+				assert.Equal(t, ReasonIOServerDisconnect, reason)
+			})
+			socket.Connect()
+		}
+		connected.WaitTimeout(t, defaultTestWaitTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTestWaitTimeout)
+		defer cancel()
+		err := server.Shutdown(ctx)
+		require.NoError(t, err)
+
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
+
+	t.Run("`Shutdown` should disconnect the sockets after the jitter", func(t *testing.T) {
+		server, _, manager := newTestServerAndClient(
+			t,
+			&ServerConfig{EIO: eio.ServerConfig{ShutdownJitter: time.Hour}},
+			&ManagerConfig{NoReconnection: true},
+		)
+		socket := manager.Socket("/", nil)
+		tw := newTestWaiter(1)
+		connected := newTestWaiter(1)
+		var disconnected atomic.Bool
+
+		server.OnConnection(func(socket ServerSocket) {
+			socket.OnDisconnect(func(reason Reason) {
+				defer tw.Done()
+				disconnected.Store(true)
+				assert.Equal(t, ReasonServerShuttingDown, reason)
+			})
+			connected.Done()
+		})
+		socket.Connect()
+		connected.WaitTimeout(t, defaultTestWaitTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			// The socket must not be disconnected before its delay is over (or ctx is done).
+			assert.False(t, disconnected.Load())
+		}()
+		err := server.Shutdown(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
+
+	t.Run("should work with the memory transport", func(t *testing.T) {
+		server := NewServer(&ServerConfig{EIO: eio.ServerConfig{Transports: []string{"polling", "websocket", "memory"}}})
+		err := server.Run()
+		require.NoError(t, err)
+		defer server.Close()
+		memory.Register("sio-server-test", server)
+		defer memory.Unregister("sio-server-test")
+
+		manager := NewManager("memory://sio-server-test", nil)
+		socket := manager.Socket("/", nil)
+		tw := newTestWaiter(2)
+
+		server.OnConnection(func(socket ServerSocket) {
+			socket.OnEvent("hello", func(message string, ack func(reply string)) {
+				defer tw.Done()
+				assert.Equal(t, "hi", message)
+				ack("hello")
+			})
+		})
+		socket.Emit("hello", "hi", func(reply string) {
+			defer tw.Done()
+			assert.Equal(t, "hello", reply)
+		})
+		socket.Connect()
+
+		tw.WaitTimeout(t, defaultTestWaitTimeout)
+	})
 }
 
 func newTestServerAndClient(
@@ -176,3 +549,76 @@ func newTestServerAndClient(
 
 	return server, httpServer, manager
 }
+
+// Records the data read from the connection.
+type recordingConn struct {
+	net.Conn
+
+	mu   sync.Mutex
+	read bytes.Buffer
+}
+
+func (c *recordingConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	c.mu.Lock()
+	c.read.Write(p[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *recordingConn) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.read.Bytes())
+}
+
+type webSocketMessage struct {
+	compressed bool
+	data       []byte // Only set if the message is not compressed.
+}
+
+// Read the messages sent by a server from the raw data of a websocket connection (including the HTTP response).
+func readWebSocketMessages(t *testing.T, b []byte) (messages []webSocketMessage) {
+	i := bytes.Index(b, []byte("\r\n\r\n"))
+	require.NotEqual(t, -1, i)
+	b = b[i+4:]
+
+	var message *webSocketMessage
+	for len(b) >= 2 {
+		var (
+			fin    = b[0]&0x80 != 0
+			rsv1   = b[0]&0x40 != 0
+			opcode = b[0] & 0x0f
+			n      = int(b[1] & 0x7f)
+		)
+		b = b[2:]
+		switch n {
+		case 126:
+			n = int(binary.BigEndian.Uint16(b))
+			b = b[2:]
+		case 127:
+			n = int(binary.BigEndian.Uint64(b))
+			b = b[8:]
+		}
+		require.LessOrEqual(t, n, len(b))
+		payload := b[:n]
+		b = b[n:]
+
+		// Skip the control frames.
+		if opcode >= 0x8 {
+			continue
+		}
+		if message == nil {
+			// The compression bit is set on the first frame of a message.
+			message = &webSocketMessage{compressed: rsv1}
+		}
+		if !message.compressed {
+			message.data = append(message.data, payload...)
+		}
+		if fin {
+			messages = append(messages, *message)
+			message = nil
+		}
+	}
+	return messages
+}
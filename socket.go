@@ -31,6 +31,13 @@ type Socket interface {
 	// Return an emitter with timeout set.
 	Timeout(timeout time.Duration) Emitter
 
+	// Return an emitter with the compression flag set.
+	//
+	// If compress is false, the event data will be sent without compression
+	// (only applies to the websocket transport with permessage-deflate enabled,
+	// and to the polling transport with HTTP compression enabled).
+	Compress(compress bool) Emitter
+
 	// Register an event handler.
 	OnEvent(eventName string, handler any)
 
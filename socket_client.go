@@ -1,5 +1,7 @@
 package sio
 
+import "context"
+
 type (
 	ClientSocket interface {
 		Socket
@@ -11,6 +13,13 @@ type (
 		// Connect the socket.
 		Connect()
 
+		// Connect the socket and wait until it is connected to the namespace.
+		//
+		// A non-nil error is returned if the server rejects the connection (a *ConnectError),
+		// if the connection fails and the manager is not going to reconnect, or if ctx is done.
+		// If ctx is done, the socket is disconnected (reconnection attempts are stopped) and ctx.Err() is returned.
+		ConnectContext(ctx context.Context) error
+
 		// Disconnect the socket (a DISCONNECT packet will be sent).
 		Disconnect()
 
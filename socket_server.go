@@ -1,6 +1,9 @@
 package sio
 
-import mapset "github.com/deckarep/golang-set/v2"
+import (
+	mapset "github.com/deckarep/golang-set/v2"
+	eio "github.com/tomruk/socket.io-go/engine.io"
+)
 
 type (
 	ServerSocket interface {
@@ -13,6 +16,16 @@ type (
 		// Retrieves the Namespace this socket is connected to.
 		Namespace() *Namespace
 
+		// Transport statistics of the underlying Engine.IO connection.
+		// Sockets of the same client (connected to different namespaces) share the same statistics.
+		Stats() eio.SocketStats
+
+		// Details of the handshake: the authentication data sent with the CONNECT packet
+		// and the HTTP request that established the underlying Engine.IO connection.
+		//
+		// This is the equivalent of `socket.handshake` in original Socket.IO.
+		Handshake() *Handshake
+
 		// Join room(s)
 		Join(room ...Room)
 		// Leave a room
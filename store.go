@@ -6,6 +6,7 @@ import (
 	"github.com/tomruk/socket.io-go/internal/sync"
 
 	"github.com/tomruk/socket.io-go/adapter"
+	eioparser "github.com/tomruk/socket.io-go/engine.io/parser"
 	"github.com/tomruk/socket.io-go/parser"
 )
 
@@ -73,6 +74,8 @@ func newNspSocketStore() *nspSocketStore {
 	return &nspSocketStore{sockets: make(map[SocketID]ServerSocket)}
 }
 
+var _ adapter.PacketSocketStore = (*adapterSocketStore)(nil)
+
 func newAdapterSocketStore(store *nspSocketStore) *adapterSocketStore {
 	return &adapterSocketStore{store: store}
 }
@@ -203,6 +206,16 @@ func (s *nspStore) len() int {
 	return len(s.nsps)
 }
 
+func (s *nspStore) getAll() []*Namespace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nsps := make([]*Namespace, 0, len(s.nsps))
+	for _, nsp := range s.nsps {
+		nsps = append(nsps, nsp)
+	}
+	return nsps
+}
+
 func (s *nspStore) set(nsp *Namespace) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -229,7 +242,19 @@ func (s *nspSocketStore) sendBuffers(sid SocketID, buffers [][]byte) (ok bool) {
 		return false
 	}
 	socket := _socket.(*serverSocket)
-	socket.conn.sendBuffers(buffers...)
+	socket.conn.sendBuffers(true, buffers...)
+	return true
+}
+
+func (s *nspSocketStore) sendPackets(sid SocketID, packets []*eioparser.Packet) (ok bool) {
+	_socket, ok := s.get(sid)
+	if !ok {
+		return false
+	}
+	socket := _socket.(*serverSocket)
+	if len(packets) > 0 {
+		socket.conn.packet(packets...)
+	}
 	return true
 }
 
@@ -270,6 +295,20 @@ func (s *adapterSocketStore) SendBuffers(sid SocketID, buffers [][]byte) (ok boo
 	return s.store.sendBuffers(sid, buffers)
 }
 
+// The packets are never modified after they're created, so they can be queued by multiple sockets.
+func (s *adapterSocketStore) NewPackets(buffers [][]byte, compress bool) ([]*eioparser.Packet, error) {
+	packets, err := newEIOPackets(compress, buffers...)
+	if err != nil {
+		return nil, err
+	}
+	// Limit the capacity, so that appending to the packets (e.g. in a packet queue) never modifies the shared array.
+	return packets[:len(packets):len(packets)], nil
+}
+
+func (s *adapterSocketStore) SendPackets(sid SocketID, packets []*eioparser.Packet) (ok bool) {
+	return s.store.sendPackets(sid, packets)
+}
+
 func (s *adapterSocketStore) Get(sid SocketID) (socket adapter.Socket, ok bool) {
 	return s.store.get(sid)
 }
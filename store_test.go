@@ -3,12 +3,16 @@ package sio
 import (
 	"fmt"
 	"reflect"
+	"runtime"
 	"testing"
 
 	"github.com/tomruk/socket.io-go/internal/sync"
 
 	"github.com/stretchr/testify/require"
+	"github.com/tomruk/socket.io-go/adapter"
 	"github.com/tomruk/socket.io-go/parser"
+	jsonparser "github.com/tomruk/socket.io-go/parser/json"
+	"github.com/tomruk/socket.io-go/parser/json/serializer/stdjson"
 )
 
 func TestClientSocketStore(t *testing.T) {
@@ -191,6 +195,8 @@ func TestNamespaceSocketStore(t *testing.T) {
 	// There is no such socket.
 	ok = store.sendBuffers("", nil)
 	require.False(t, ok)
+	ok = store.sendPackets("", nil)
+	require.False(t, ok)
 
 	tw.Add(1)
 	manager.Socket("/", nil).OnEvent("hi", func(message string) {
@@ -445,3 +451,57 @@ func TestEventHandlerStore(t *testing.T) {
 		require.Equal(t, 0, len(all))
 	})
 }
+
+func TestAdapterSocketStoreNewPackets(t *testing.T) {
+	store := newAdapterSocketStore(newNspSocketStore())
+	buffers := [][]byte{[]byte(`52-["hello",{"_placeholder":true,"num":0}]`), {0x0, 0x1}}
+
+	packets, err := store.NewPackets(buffers, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(packets))
+	require.False(t, packets[0].IsBinary)
+	require.True(t, packets[1].IsBinary)
+	require.False(t, packets[0].SkipCompression)
+	// Appending to the packets must not modify the shared array.
+	require.Equal(t, len(packets), cap(packets))
+
+	packets, err = store.NewPackets(buffers, false)
+	require.NoError(t, err)
+	require.True(t, packets[0].SkipCompression)
+	require.True(t, packets[1].SkipCompression)
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	const recipients = 1000
+
+	store := newNspSocketStore()
+	parserCreator := jsonparser.NewCreator(0, stdjson.New())
+	a := adapter.NewInMemoryAdapterCreator()(newAdapterSocketStore(store), parserCreator)
+	for i := 0; i < recipients; i++ {
+		socket := &serverSocket{
+			id:   SocketID(fmt.Sprint(i)),
+			conn: &serverConn{eioPacketQueue: newPacketQueue()},
+		}
+		store.set(socket)
+		a.AddAll(socket.id, []Room{Room(socket.id)})
+	}
+	sockets := store.getAll()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		header := &parser.PacketHeader{Type: parser.PacketTypeEvent, Namespace: "/"}
+		a.Broadcast(header, []any{"message", "hello", i}, adapter.NewBroadcastOptions())
+		// Drain the queues, as the Engine.IO sockets would.
+		for _, socket := range sockets {
+			socket.(*serverSocket).conn.eioPacketQueue.get()
+		}
+	}
+
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N*recipients), "allocs/recipient")
+}